@@ -0,0 +1,96 @@
+// Filename: cmd/api/apikeys.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The listApiKeysHandler() returns the API keys of the user for the
+// "GET" /v1/apikeys" endpoint. The keys themselves are never shown again
+func (app *application) listApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	keys, err := app.models.ApiKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createApiKeyHandler() creates a named API key for the "POST" /v1/apikeys"
+// endpoint. The key has every permission of the user unless a subset is given
+func (app *application) createApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	granted, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	key := &data.ApiKey{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		Expiry:      input.Expiry,
+	}
+	if key.Permissions == nil {
+		key.Permissions = granted
+	}
+	v := validator.New()
+	if data.ValidateApiKey(v, key, granted); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.ApiKeys.Insert(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteApiKeyHandler() revokes an API key for the "DELETE" /v1/apikeys/:id"
+// endpoint
+func (app *application) deleteApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.ApiKeys.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
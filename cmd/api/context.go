@@ -0,0 +1,65 @@
+// Filename: cmd/api/context.go
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"todo.osborncollins.net/internal/data"
+)
+
+// Define a custom type for our request context keys
+type contextKey string
+
+const (
+	userContextKey   = contextKey("user")
+	apiKeyContextKey = contextKey("apiKey")
+	// Identifies a request across the log lines it produces
+	requestIDContextKey = contextKey("requestID")
+)
+
+// The contextSetUser() method returns a copy of the request with the user
+// added to its context
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() method returns the user from the request context. The
+// authenticate middleware always sets one so a missing user is a bug
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// The contextSetApiKey() method returns a copy of the request with the API
+// key used to authenticate added to its context
+func (app *application) contextSetApiKey(r *http.Request, key *data.ApiKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// The contextGetApiKey() method returns the API key used to authenticate the
+// request or nil when the request was not authenticated with one
+func (app *application) contextGetApiKey(r *http.Request) *data.ApiKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.ApiKey)
+	return key
+}
+
+// The contextSetRequestID() method returns a copy of the request with the
+// request ID added to its context
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRequestID() method returns the ID of the request or an
+// empty string when none was set
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
@@ -0,0 +1,193 @@
+// Filename: cmd/api/dependencies.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// createDependencyHandler for the "POST" /v1/todoitems/:id/dependencies" endpoint
+func (app *application) createDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Our Target decode destination
+	var input struct {
+		DependsOn int64 `json:"depends_on"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Make sure both todo items exist and the user can edit the first one
+	v := validator.New()
+	err = app.validateDependency(v, user.ID, id, input.DependsOn)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, errNotPermitted):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Record the dependency
+	err = app.models.Dependencies.Insert(id, input.DependsOn, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("depends_on", "must reference an existing todo item")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDependencyCycle):
+			v.AddError("depends_on", "must not create a dependency cycle")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateDependency):
+			v.AddError("depends_on", "the todo item already depends on this item")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeDependencies(w, r, id, http.StatusCreated)
+}
+
+// deleteDependencyHandler for the "DELETE" /v1/todoitems/:id/dependencies" endpoint
+func (app *application) deleteDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Our Target decode destination
+	var input struct {
+		DependsOn int64 `json:"depends_on"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Make sure the user can edit the todo item
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !todo.CanEdit() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	// Remove the dependency. Send a 404 Not Found status code to the
+	// client if there is no matching record
+	err = app.models.Dependencies.Delete(id, input.DependsOn)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeDependencies(w, r, id, http.StatusOK)
+}
+
+// criticalPathHandler for the "GET" /v1/todoitems/:id/critical-path" endpoint
+func (app *application) criticalPathHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the todo item exists
+	_, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	path, err := app.models.Dependencies.CriticalPath(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"critical_path": path}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The validateDependency() method checks that the todo item exists and that the
+// item it should depend on exists. The user must be able to edit the todo item
+// and see the other one. A missing dependency is a validation error
+func (app *application) validateDependency(v *validator.Validator, userID int64, id int64, dependsOn int64) error {
+	todo, err := app.models.Todos.Get(id, userID)
+	if err != nil {
+		return err
+	}
+	if !todo.CanEdit() {
+		return errNotPermitted
+	}
+	v.Check(dependsOn > 0, "depends_on", "must be provided")
+	v.Check(dependsOn != id, "depends_on", "must not reference the todo item itself")
+	if !v.Valid() {
+		return nil
+	}
+	_, err = app.models.Todos.Get(dependsOn, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("depends_on", "must reference an existing todo item")
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// The writeDependencies() method responds with the current dependencies of a
+// todo item which the user can see
+func (app *application) writeDependencies(w http.ResponseWriter, r *http.Request, id int64, status int) {
+	user := app.contextGetUser(r)
+	blockedBy, err := app.models.Dependencies.GetBlockedBy(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	blocks, err := app.models.Dependencies.GetBlocks(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, status, envelope{"blocked_by": blockedBy, "blocks": blocks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
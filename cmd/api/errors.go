@@ -3,18 +3,35 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// errNotPermitted is returned by helpers when the user's role on a todo item
+// does not allow the change
+var errNotPermitted = errors.New("not permitted")
+
+// The logError() method logs the error along with the request it happened on
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Println(err)
+	app.logger.PrintError(err, map[string]string{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+		"request_id":     app.contextGetRequestID(r),
+	})
 }
 
 // We want to send JSON formatted error messages
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	// Create the JSON response
+	// Create the JSON response. The request ID lets the client point us to
+	// the matching log lines
 	env := envelope{"error": message}
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
 	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
@@ -61,3 +78,73 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	message := "unable to update the record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+// Status workflow errors list the statuses the item can move to instead
+func (app *application) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, from string, to string, allowed []string) {
+	message := map[string]interface{}{
+		"status":           fmt.Sprintf("cannot move from %q to %q", from, to),
+		"allowed_statuses": allowed,
+	}
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+// Wrong email address or password
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="todo", charset="UTF-8"`)
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Missing, malformed or expired bearer tokens
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="todo", error="invalid_token"`)
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Unknown, revoked or expired API keys
+func (app *application) invalidApiKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `ApiKey realm="todo", error="invalid_key"`)
+	message := "invalid, revoked or expired API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Missing or wrong credentials for the metrics endpoint
+func (app *application) invalidMetricsCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+	message := "invalid or missing metrics credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Anonymous users trying to reach a protected resource are told which
+// authentication schemes are accepted
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="todo"`)
+	w.Header().Add("WWW-Authenticate", `ApiKey realm="todo"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="todo", charset="UTF-8"`)
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Users who have not activated their account yet
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// Users whose permissions do not cover the resource
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// Clients who have used up their requests are told when to try again
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
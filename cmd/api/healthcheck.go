@@ -4,16 +4,28 @@ package main
 
 import (
 	"net/http"
+	"time"
 )
 
+// The systemInfo() method returns the system information which every
+// healthcheck reports
+func (app *application) systemInfo() map[string]string {
+	return map[string]string{
+		"environment": app.config.env,
+		// The misspelled key is kept for clients which already read it
+		"enviornment": app.config.env,
+		"version":     version,
+	}
+}
+
+// The healthcheckHandler() is kept for existing clients. Like liveHandler() it
+// only reports that the server is running and does not check the database, so
+// load balancers should use /v1/healthcheck/ready instead
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Create a map to hold our healthcheck data
 	data := envelope{
-		"status": "available",
-		"system_info": map[string]string{
-			"enviornment": app.config.env,
-			"version":     version,
-		},
+		"status":      "available",
+		"system_info": app.systemInfo(),
 	}
 	err := app.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -21,3 +33,74 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// The liveHandler() reports that the server is running. It does not check the
+// database so that a database outage does not get the server restarted
+func (app *application) liveHandler(w http.ResponseWriter, r *http.Request) {
+	data := envelope{
+		"status":      "available",
+		"system_info": app.systemInfo(),
+	}
+	err := app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readyHandler() reports whether the server can handle requests. The
+// database must answer a ping and the schema must not be left half migrated,
+// otherwise a 503 Service Unavailable status code is sent
+func (app *application) readyHandler(w http.ResponseWriter, r *http.Request) {
+	status := "available"
+	// Check the database
+	stats := app.models.Database.Stats()
+	database := map[string]interface{}{
+		"status":               "up",
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration":        stats.WaitDuration.String(),
+	}
+	err := app.models.Database.Ping()
+	if err != nil {
+		app.logError(r, err)
+		status = "degraded"
+		// The driver error may name hosts and users so it is only logged
+		database["status"] = "down"
+	}
+	// Check the schema version
+	migration := map[string]interface{}{}
+	if err == nil {
+		m, err := app.models.Database.Migration()
+		switch {
+		case err != nil:
+			app.logError(r, err)
+			status = "degraded"
+			migration["error"] = "unable to read the schema version"
+		case m.Dirty:
+			status = "degraded"
+			migration["version"] = m.Version
+			migration["dirty"] = true
+		default:
+			migration["version"] = m.Version
+			migration["dirty"] = false
+		}
+	}
+	data := envelope{
+		"status":      status,
+		"system_info": app.systemInfo(),
+		"database":    database,
+		"migration":   migration,
+		"uptime":      time.Since(app.started).Round(time.Second).String(),
+	}
+	code := http.StatusOK
+	if status != "available" {
+		code = http.StatusServiceUnavailable
+	}
+	err = app.writeJSON(w, code, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -7,18 +7,36 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"todo.osborncollins.net/internal/data"
 	"todo.osborncollins.net/internal/validator"
 )
 
 // Define a new type name envelope
 type envelope map[string]interface{}
 
+// optionalTime holds a time field of a partial update. Set records whether
+// the key was in the body at all, so that an explicit null can clear the field
+type optionalTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+// The UnmarshalJSON() method is called for null as well as for a time
+func (o *optionalTime) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	return json.Unmarshal(b, &o.Value)
+}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	// Use the "ParamsFromContext()" function to get the request context as a slice
 	params := httprouter.ParamsFromContext(r.Context())
@@ -107,6 +125,163 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// The readInput() method decodes the request body into dst. JSON is the
+// default but HTML form submissions, both URL encoded and multipart, are
+// accepted as well
+func (app *application) readInput(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if app.isFormRequest(r) {
+		return app.readForm(w, r, dst)
+	}
+	return app.readJSON(w, r, dst)
+}
+
+// The mediaType() method returns the media type of the request body in
+// lower case, or an empty string when the Content-Type header is malformed
+func (app *application) mediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// The isFormRequest() method checks if the request body is an HTML form
+func (app *application) isFormRequest(r *http.Request) bool {
+	mediaType := app.mediaType(r)
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+// The wantsRedirect() method checks if the request is a form submitted by a
+// browser, which should be sent on to the new page rather than shown JSON
+func (app *application) wantsRedirect(r *http.Request) bool {
+	return app.isFormRequest(r) && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// The readForm() method decodes a form submission into dst, matching the form
+// fields to the json tags of the struct. Browsers send every input of a form
+// so empty fields are treated as not provided. A field must not be given
+// more than once unless its struct field is tagged form:"csv", in which case
+// the values are joined into a comma list
+func (app *application) readForm(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	var err error
+	if app.mediaType(r) == "multipart/form-data" {
+		err = r.ParseMultipartForm(int64(maxBytes))
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return fmt.Errorf("body contains a badly formed form: %v", err)
+	}
+	if len(r.PostForm) == 0 {
+		return errors.New("body must not be empty")
+	}
+	// dst must be a pointer to a struct, anything else is a bug
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("readForm: destination must be a pointer to a struct, got %T", dst))
+	}
+	rv = rv.Elem()
+	// Map the field names used by clients to the struct fields
+	fields := make(map[string]reflect.Value)
+	csv := make(map[string]bool)
+	for i := 0; i < rv.NumField(); i++ {
+		tag := rv.Type().Field(i).Tag
+		name, _, _ := strings.Cut(tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = rv.Field(i)
+			csv[name] = tag.Get("form") == "csv"
+		}
+	}
+	for key, values := range r.PostForm {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("body contains unknown key %q", key)
+		}
+		// Drop the empty values
+		var filled []string
+		for _, value := range values {
+			if value != "" {
+				filled = append(filled, value)
+			}
+		}
+		if len(filled) == 0 {
+			continue
+		}
+		if csv[key] {
+			filled = []string{strings.Join(filled, ",")}
+		}
+		err := setFormField(field, key, filled)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFormField() stores the values of a form field in the struct field
+func setFormField(field reflect.Value, key string, values []string) error {
+	// Every field takes a single value
+	if len(values) > 1 {
+		return fmt.Errorf("body contains key %q more than once", key)
+	}
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(values[0])
+	case *string:
+		value := values[0]
+		field.Set(reflect.ValueOf(&value))
+	case *int64:
+		i, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("body contains incorrect type for key %q, must be an integer", key)
+		}
+		field.Set(reflect.ValueOf(&i))
+	case *time.Time:
+		t, err := time.Parse(time.RFC3339, values[0])
+		if err != nil {
+			return fmt.Errorf("body contains incorrect type for key %q, must be an RFC3339 time", key)
+		}
+		field.Set(reflect.ValueOf(&t))
+	case optionalTime:
+		t, err := time.Parse(time.RFC3339, values[0])
+		if err != nil {
+			return fmt.Errorf("body contains incorrect type for key %q, must be an RFC3339 time", key)
+		}
+		field.Set(reflect.ValueOf(optionalTime{Set: true, Value: &t}))
+	default:
+		panic(fmt.Sprintf("readForm: unsupported field type %s", field.Type()))
+	}
+	return nil
+}
+
+// The singleStatus() method normalizes a status sent as a comma list, which
+// forms also use for repeated status fields. Repeats of the same status are
+// dropped. A todo item is in one workflow status at a time, so a list naming
+// more than one status adds a validation error
+func (app *application) singleStatus(v *validator.Validator, status string) string {
+	statuses := []string{}
+	for _, s := range strings.Split(status, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" && !validator.In(s, statuses...) {
+			statuses = append(statuses, s)
+		}
+	}
+	switch len(statuses) {
+	case 0:
+		return ""
+	case 1:
+		return statuses[0]
+	default:
+		v.AddError("status", "must contain a single status, the workflow keeps a todo item in one status at a time (got "+strings.Join(statuses, ", ")+")")
+		return ""
+	}
+}
+
 // The readString() method returns a string value from the query parameters
 // string or it returns a default value if no matching key is found
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
@@ -146,3 +321,74 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	return intValue
 }
+
+// The readTime() method parses an RFC 3339 timestamp from the query string.
+// If no matching key is found then nil is returned. If the value cannot be
+// parsed then a validation error is added to the validations errors map.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	value := qs.Get(key)
+	if value == "" {
+		return nil
+	}
+	// Perform the conversion to a time value
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		v.AddError(key, "must be a valid RFC 3339 timestamp")
+		return nil
+	}
+	return &t
+}
+
+// The readBool() method converts a string value from the query string to a boolean value
+// If the value cannot be converted to a boolean then a validation error is added to
+// the validations errors map.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// Perform the conversion to a boolean
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be a valid boolean value")
+		return defaultValue
+	}
+	return boolValue
+}
+
+// The actor() method identifies who made a change. The authenticated user is
+// preferred, then the X-Actor header and finally the client address
+func (app *application) actor(r *http.Request) string {
+	if user, ok := r.Context().Value(userContextKey).(*data.User); ok && !user.IsAnonymous() {
+		return user.Email
+	}
+	actor := strings.TrimSpace(r.Header.Get("X-Actor"))
+	if actor != "" {
+		if len(actor) > 100 {
+			actor = actor[:100]
+		}
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// The background() method runs fn in its own goroutine and recovers from any
+// panic so that a failing background task does not bring down the server.
+// Shutdown waits for fn to return, so long running loops should stop once
+// app.done is closed
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("background task panic: %v", err), nil)
+			}
+		}()
+		fn()
+	}()
+}
@@ -0,0 +1,210 @@
+// Filename: cmd/api/lists.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// createListHandler for the "POST" /v1/lists" endpoint
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	// Our Target decode destination
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	list := &data.List{
+		OwnerID: app.contextGetUser(r).ID,
+		Name:    input.Name,
+	}
+	// initialize a new Validator instance
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Create a List Object
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateList):
+			v.AddError("name", "a list with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Create a location header for the newly created list
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showListHandler for the "GET" /v1/lists/:id" endpoint
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateListHandler for the "PATCH" /v1/lists/:id" endpoint renames,
+// archives or restores a list
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	// Fetch the original record from the database
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name     *string `json:"name"`
+		Archived *bool   `json:"archived"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Archived != nil {
+		list.Archived = *input.Archived
+	}
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Lists.Update(list, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateList):
+			v.AddError("name", "a list with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteListHandler for the "DELETE" /v1/lists/:id" endpoint
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Lists.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listListsHandler for the "GET" /v1/lists" endpoint. Archived lists are
+// only shown with "archived=true"
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name     string
+		Archived bool
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Name = app.readString(qs, "name", "")
+	input.Archived = app.readBool(qs, "archived", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortList = []string{"id", "name", "-id", "-name"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	lists, metadata, err := app.models.Lists.GetAll(user.ID, input.Name, input.Archived, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listListTODOItemsHandler for the "GET" /v1/lists/:id/todoitems" endpoint
+func (app *application) listListTODOItemsHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	app.listTODOItems(w, r, list.ID)
+}
+
+// createListTODOItemHandler for the "POST" /v1/lists/:id/todoitems" endpoint
+func (app *application) createListTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	app.createTODOItem(w, r, list)
+}
+
+// The readList() method fetches the user's list named by the id parameter. If
+// the list cannot be found then a response is written and ok is false
+func (app *application) readList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	list, err := app.models.Lists.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return list, true
+}
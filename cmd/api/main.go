@@ -4,15 +4,18 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
-	"fmt"
-	"log"
-	"net/http"
+	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/jsonlog"
+	"todo.osborncollins.net/internal/mailer"
 )
 
 // The Application Version Number
@@ -28,13 +31,49 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	workflowFile    string        // Optional JSON file describing the status workflow
+	shutdownTimeout time.Duration // How long in-flight requests get to finish on shutdown
+	trash           struct {
+		retention     time.Duration // How long deleted items stay in the trash
+		purgeInterval time.Duration // How often the trash is purged
+	}
+	limiter struct {
+		rps            float64      // Requests per second allowed for each client
+		burst          int          // Requests a client can make in a single burst
+		enabled        bool         // Whether rate limiting is switched on
+		trustedProxies []*net.IPNet // Proxies whose X-Forwarded-For header is believed
+	}
+	metrics struct {
+		addr     string // Address of the metrics server, empty to switch it off
+		username string // Basic authentication for the metrics endpoint
+		password string
+	}
+	cors struct {
+		trustedOrigins []string // Origins allowed to make cross-origin requests
+	}
+	claim struct {
+		email    string // Claims the legacy owner account with these credentials and exits
+		password string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
 }
 
 // Dependency Injection
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	workflow *data.Workflow
+	mailer   mailer.Mailer
+	wg       sync.WaitGroup // Tracks the goroutines started by background()
+	done     chan struct{}  // Closed when the server shuts down
+	started  time.Time      // When the application started, for the uptime
 }
 
 func main() {
@@ -47,46 +86,113 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 20*time.Second, "Time allowed for in-flight requests to finish on shutdown")
+	flag.StringVar(&cfg.workflowFile, "workflow-file", "", "Status workflow JSON file (default pending/in-progress/completed/cancelled)")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted todo items are kept in the trash")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired todo items are purged from the trash")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Func("limiter-trusted-proxies", "Trusted proxy addresses or CIDR ranges (space separated)", func(val string) error {
+		for _, proxy := range strings.Fields(val) {
+			// A single address is treated as a range of one
+			if !strings.Contains(proxy, "/") {
+				if strings.Contains(proxy, ":") {
+					proxy += "/128"
+				} else {
+					proxy += "/32"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return err
+			}
+			cfg.limiter.trustedProxies = append(cfg.limiter.trustedProxies, ipNet)
+		}
+		return nil
+	})
+	flag.StringVar(&cfg.metrics.addr, "metrics-addr", "", "Address of the /debug/vars metrics server (empty to disable)")
+	flag.StringVar(&cfg.metrics.username, "metrics-username", os.Getenv("TODO_METRICS_USERNAME"), "Metrics basic auth username")
+	flag.StringVar(&cfg.metrics.password, "metrics-password", os.Getenv("TODO_METRICS_PASSWORD"), "Metrics basic auth password")
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+		cfg.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+	flag.StringVar(&cfg.claim.email, "claim-email", "", "Claim the legacy owner account with this email address and exit")
+	flag.StringVar(&cfg.claim.password, "claim-password", os.Getenv("TODO_CLAIM_PASSWORD"), "Password for the claimed legacy owner account")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("TODO_SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("TODO_SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Todo <no-reply@todo.osborncollins.net>", "SMTP sender")
 	flag.Parse()
 
 	//Create a logger
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	// The trash purge loop needs a positive interval and retention
+	if cfg.trash.purgeInterval <= 0 {
+		logger.PrintFatal(errors.New("-trash-purge-interval must be greater than zero"), nil)
+	}
+	if cfg.trash.retention <= 0 {
+		logger.PrintFatal(errors.New("-trash-retention must be greater than zero"), nil)
+	}
+	// The metrics server is never served without credentials
+	if cfg.metrics.addr != "" && (cfg.metrics.username == "" || cfg.metrics.password == "") {
+		logger.PrintFatal(errors.New("-metrics-username and -metrics-password must be set when -metrics-addr is set"), nil)
+	}
+	// Load the status workflow
+	workflow := &data.DefaultWorkflow
+	if cfg.workflowFile != "" {
+		wf, err := data.LoadWorkflow(cfg.workflowFile)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		workflow = wf
+	}
 	// Create the connection pool
 	db, err := openDB(cfg)
 	if err != nil {
-		logger.Fatal(err)
+		logger.PrintFatal(err, nil)
 	}
 
 	//Create an instance of our application struct
 	// We are using the application struct for dependecy injection
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:   cfg,
+		logger:   logger,
+		models:   data.NewModels(db),
+		workflow: workflow,
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		done:     make(chan struct{}),
+		started:  time.Now(),
 	}
+	// The progress of parent items follows the done statuses of the workflow
+	app.models.Todos.Done = workflow.Done
 	// If anything happens we would like to close connection
 	defer db.Close()
 	//Log the sucessful connection pool
-	logger.Println("Database connection pool established")
-
-	// Create our new servemux
-	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
-
-	// Create HTTP Server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	logger.PrintInfo("database connection pool established", nil)
+	// Hand the items which predate user accounts over to an administrator
+	if cfg.claim.email != "" {
+		err = app.claimLegacyOwner(cfg.claim.email, cfg.claim.password)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("claimed the legacy owner account", map[string]string{
+			"email": cfg.claim.email,
+		})
+		return
 	}
+	// Publish the application and connection pool statistics
+	publishMetrics(db)
+	// Permanently remove todo items which have been in the trash too long
+	app.background(app.purgeTrash)
 
 	// Start our Server
-	logger.Printf("Starting %s Server on %s", cfg.env, srv.Addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
-
+	err = app.serve()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 }
 
 //The openDB() function returns a pointer to an sql.DB connection pool
@@ -0,0 +1,159 @@
+// Filename: cmd/api/metrics.go
+
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The expvar variables can only be registered once per process, so they are
+// created here rather than each time the routes or middleware are built
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+	routeLatency                    = expvar.NewMap("route_latency")
+	requestsInFlight                int64
+)
+
+// Guards the variables which publishMetrics() registers
+var publishOnce sync.Once
+
+// The publishMetrics() function registers the application version and the
+// runtime and database statistics. Only the first call has any effect
+func publishMetrics(db *sql.DB) {
+	publishOnce.Do(func() {
+		expvar.NewString("version").Set(version)
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+		expvar.Publish("database", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+		expvar.Publish("timestamp", expvar.Func(func() interface{} {
+			return time.Now().Unix()
+		}))
+		expvar.Publish("requests_in_flight", expvar.Func(func() interface{} {
+			return atomic.LoadInt64(&requestsInFlight)
+		}))
+	})
+}
+
+// The upper bounds in milliseconds of the latency histogram buckets
+var latencyBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// histogram counts observed durations in cumulative buckets. It implements
+// expvar.Var so that it can be published in an expvar.Map
+type histogram struct {
+	mu     sync.Mutex
+	counts []int64 // One count per bucket plus one for anything slower
+	count  int64
+	sumMs  float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]int64, len(latencyBuckets)+1)}
+}
+
+// The observe() method adds a single duration to the histogram
+func (h *histogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(latencyBuckets) && ms > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sumMs += ms
+}
+
+// The String() method returns the histogram as JSON. Each bucket holds the
+// number of requests which took at most that many milliseconds
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make(map[string]int64, len(h.counts))
+	var cumulative int64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = strconv.FormatFloat(latencyBuckets[i], 'f', -1, 64)
+		}
+		buckets[le] = cumulative
+	}
+	js, _ := json.Marshal(map[string]interface{}{
+		"buckets_ms": buckets,
+		"count":      h.count,
+		"sum_ms":     h.sumMs,
+	})
+	return string(js)
+}
+
+// metricsRouter registers routes on the httprouter so that the latency of
+// each route is recorded under its method and path pattern
+type metricsRouter struct {
+	*httprouter.Router
+	latency *expvar.Map
+}
+
+// The HandlerFunc() method registers the handler and times every call to it
+func (mr *metricsRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	h := newHistogram()
+	mr.latency.Set(method+" "+path, h)
+	mr.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler(w, r)
+		h.observe(time.Since(start))
+	})
+}
+
+// The metrics() middleware counts the requests, the responses by status code
+// and the requests which are still being processed
+func (app *application) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		totalRequestsReceived.Add(1)
+		atomic.AddInt64(&requestsInFlight, 1)
+		defer atomic.AddInt64(&requestsInFlight, -1)
+		rw := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		totalResponsesSent.Add(1)
+		totalResponsesSentByStatus.Add(strconv.Itoa(rw.statusCode), 1)
+		totalProcessingTimeMicroseconds.Add(time.Since(start).Microseconds())
+	})
+}
+
+// The metricsHandler() method serves the published expvar variables. The
+// client must send the metrics username and password with HTTP Basic
+// authentication. main() refuses to start the metrics server unless both
+// are configured
+func (app *application) metricsHandler() http.Handler {
+	vars := expvar.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		// Compare in constant time so the credentials cannot be guessed
+		// from the response times
+		usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(app.config.metrics.username)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(app.config.metrics.password)) == 1
+		if !ok || !usernameMatch || !passwordMatch || app.config.metrics.password == "" {
+			app.invalidMetricsCredentialsResponse(w, r)
+			return
+		}
+		vars.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,404 @@
+// Filename: cmd/api/middleware.go
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The authenticate() middleware identifies the user making the request from
+// a bearer token, an API key or their email address and password sent with
+// HTTP Basic authentication. Requests without credentials carry the
+// AnonymousUser while bad credentials are rejected
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the Authorization header
+		w.Header().Add("Vary", "Authorization")
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+		scheme, token, _ := strings.Cut(authorizationHeader, " ")
+		switch {
+		case strings.EqualFold(scheme, "Bearer"):
+			app.authenticateToken(w, r, next, token)
+			return
+		case strings.EqualFold(scheme, "ApiKey"):
+			app.authenticateApiKey(w, r, next, token)
+			return
+		}
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		v := validator.New()
+		data.ValidateEmail(v, email)
+		data.ValidatePasswordPlaintext(v, password)
+		if !v.Valid() {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		user, err := app.models.Users.GetByEmail(email)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidCredentialsResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		match, err := user.Password.Matches(password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !match {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticateToken() method identifies the user from a bearer token
+func (app *application) authenticateToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	r = app.contextSetUser(r, user)
+	next.ServeHTTP(w, r)
+}
+
+// The authenticateApiKey() method identifies the user from an API key. The
+// key is kept in the request context so its permissions can be checked
+func (app *application) authenticateApiKey(w http.ResponseWriter, r *http.Request, next http.Handler, keyPlaintext string) {
+	v := validator.New()
+	if data.ValidateApiKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		app.invalidApiKeyResponse(w, r)
+		return
+	}
+	key, user, err := app.models.ApiKeys.GetForKey(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidApiKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	r = app.contextSetUser(r, user)
+	r = app.contextSetApiKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// The requireAuthenticatedUser() middleware turns away anonymous users
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireActivatedUser() middleware turns away anonymous users and users
+// who have not activated their account
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The requireUserCredentials() middleware turns away requests made with an
+// API key, as well as anonymous and inactive users. API keys are managed with
+// the user's own credentials so that a leaked key cannot list, create or
+// revoke keys
+func (app *application) requireUserCredentials(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetApiKey(r) != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireActivatedUser(fn)
+}
+
+// The requirePermission() middleware turns away users who have not been
+// granted the permission code. Requests made with an API key are also
+// limited to the permissions of the key
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		if key := app.contextGetApiKey(r); key != nil && !key.Permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireActivatedUser(fn)
+}
+
+// The recoverPanic() middleware turns a panic in a handler into a 500 Internal
+// Server Error response. The error log entry carries the stack trace
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// Make Go's HTTP server close the connection after the response
+				w.Header().Set("Connection", "close")
+				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The enableCORS() middleware lets the trusted origins read our responses.
+// Preflight requests are answered here with the methods and headers which
+// the API accepts
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the Origin header so caches must key on it
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			for _, trusted := range app.config.cors.trustedOrigins {
+				if origin != trusted {
+					continue
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				// Let browser clients read the request ID of the response
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+				// A preflight request is an OPTIONS request which names the
+				// method of the request it is checking
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Actor, X-Request-ID")
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDRx matches the request IDs accepted from clients. Anything else is
+// replaced so that clients cannot write arbitrary text into our logs
+var requestIDRx = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// The requestID() middleware gives every request an ID which ties together
+// the log lines it produces. A valid X-Request-ID header sent by the client
+// is used, otherwise a random ID is generated. The ID is sent back in the
+// X-Request-ID response header
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRx.MatchString(id) {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+		r = app.contextSetRequestID(r, id)
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseRecorder remembers the status code and the size of the response
+// sent to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode    int
+	bytes         int
+	headerWritten bool
+}
+
+func (rw *responseRecorder) WriteHeader(statusCode int) {
+	if !rw.headerWritten {
+		rw.statusCode = statusCode
+		rw.headerWritten = true
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	// Writing without calling WriteHeader() first sends 200 OK
+	rw.headerWritten = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// The Unwrap() method returns the original http.ResponseWriter
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// The logRequest() middleware writes an access log line for every request
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		app.logger.PrintInfo("request", map[string]string{
+			"request_id":  app.contextGetRequestID(r),
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      strconv.Itoa(rw.statusCode),
+			"bytes":       strconv.Itoa(rw.bytes),
+			"duration":    time.Since(start).String(),
+			"remote_addr": r.RemoteAddr,
+		})
+	})
+}
+
+// The rateLimit() middleware gives every client a token bucket keyed by its
+// IP address and turns away requests once the bucket is empty
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+	// Forget clients which have not been seen for a while
+	app.background(func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-app.done:
+				return
+			}
+			mu.Lock()
+			for ip, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := app.clientIP(r)
+		mu.Lock()
+		if _, found := clients[ip]; !found {
+			clients[ip] = &client{
+				limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+			}
+		}
+		clients[ip].lastSeen = time.Now()
+		reservation := clients[ip].limiter.Reserve()
+		mu.Unlock()
+		// A reservation which has to wait means the bucket is empty
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			app.rateLimitExceededResponse(w, r, delay)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The clientIP() method returns the address of the client. X-Forwarded-For
+// is only believed when the request comes from a trusted proxy, and is read
+// from the right so that clients cannot forge their own entries
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !app.trustedProxy(host) {
+		return host
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		if !app.trustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+// The trustedProxy() method checks if an address belongs to a trusted proxy
+func (app *application) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range app.config.limiter.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
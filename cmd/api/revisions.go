@@ -0,0 +1,203 @@
+// Filename: cmd/api/revisions.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The listRevisionsHandler() returns the change history of a todo item
+func (app *application) listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The history is always ordered by version
+	input.Filters.Sort = "version"
+	input.Filters.SortList = []string{"version"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Make sure the todo item exists
+	_, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	revisions, metadata, err := app.models.Revisions.GetAll(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showRevisionHandler() returns a todo item as it was at a specific version
+func (app *application) showRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	params := httprouter.ParamsFromContext(r.Context())
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the todo item exists
+	_, err = app.models.Todos.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revertTODOItemHandler() puts the fields of a todo item back to the way
+// they were at an earlier version. The revert is saved as a new version using
+// the same optimistic locking as an update
+func (app *application) revertTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be provided and greater than zero")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Fetch the current record from the database
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Viewers cannot change the item
+	if !todo.CanEdit() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "must reference a version in the history of the todo item")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	prev := *todo
+	// Copy the editable fields from the snapshot. Tags and the position are
+	// managed through their own endpoints and are left as they are
+	snapshot := revision.Snapshot
+	todo.Task_Name = snapshot.Task_Name
+	todo.Description = snapshot.Description
+	todo.Notes = snapshot.Notes
+	todo.Category = snapshot.Category
+	todo.Priority = snapshot.Priority
+	todo.StartAt = snapshot.StartAt
+	todo.DueAt = snapshot.DueAt
+	todo.Recurrence = snapshot.Recurrence
+	todo.ParentID = snapshot.ParentID
+	todo.ListID = snapshot.ListID
+	// Going back to the old status must still follow the workflow
+	if snapshot.Status != todo.Status {
+		if !app.workflow.CanTransition(todo.Status, snapshot.Status) {
+			app.invalidTransitionResponse(w, r, todo.Status, snapshot.Status, app.workflow.Allowed(todo.Status))
+			return
+		}
+		app.workflow.SetStatus(todo, snapshot.Status)
+	}
+	// The old values must still be valid today
+	data.ValidateTodo(v, todo)
+	v.Check(validator.In(todo.Status, app.workflow.States()...), "status", "must be one of "+strings.Join(app.workflow.States(), ", "))
+	err = app.validateParent(v, todo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if todo.ListID != nil && (prev.ListID == nil || *prev.ListID != *todo.ListID) {
+		err = app.validateList(v, todo)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Todos.Revert(todo, user.ID, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrParentCycle):
+			// Another item was moved under this one since it was validated
+			v.AddError("parent_id", "must not be one of the todo item's own subtasks")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
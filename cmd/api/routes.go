@@ -8,17 +8,55 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+func (app *application) routes() http.Handler {
 	// Create a new httprouter router instance
-	router := httprouter.New()
+	// Every route registered on it records its latency
+	router := &metricsRouter{Router: httprouter.New(), latency: routeLatency}
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/todoitems", app.listTODOItemsHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/todoitems", app.createTODOItemHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id", app.showTODOItemHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/todoitems/:id", app.updateTODOItemHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/todoitems/:id", app.deleteTODOItemHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.liveHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readyHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems", app.requirePermission("todos:read", app.listTODOItemsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems", app.requirePermission("todos:write", app.createTODOItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id", app.requirePermission("todos:read", app.showTODOItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/todoitems/:id", app.requirePermission("todos:write", app.updateTODOItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todoitems/:id", app.requirePermission("todos:write", app.deleteTODOItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/restore", app.requirePermission("todos:write", app.restoreTODOItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/history", app.requirePermission("todos:read", app.listRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/history/:version", app.requirePermission("todos:read", app.showRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/revert", app.requirePermission("todos:write", app.revertTODOItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/occurrences", app.requirePermission("todos:read", app.listTODOItemOccurrencesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/children", app.requirePermission("todos:read", app.listTODOItemChildrenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/move", app.requirePermission("todos:write", app.moveTODOItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/dependencies", app.requirePermission("todos:write", app.createDependencyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todoitems/:id/dependencies", app.requirePermission("todos:write", app.deleteDependencyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/critical-path", app.requirePermission("todos:read", app.criticalPathHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/tags", app.requirePermission("todos:write", app.attachTagsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todoitems/:id/tags", app.requirePermission("todos:write", app.detachTagsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todoitems/:id/shares", app.requirePermission("todos:read", app.listSharesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todoitems/:id/shares", app.requirePermission("todos:write", app.createShareHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todoitems/:id/shares", app.requirePermission("todos:write", app.deleteShareHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.requirePermission("todos:read", app.listTrashHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission("todos:read", app.listTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags", app.requirePermission("todos:write", app.createTagHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tags/:id", app.requirePermission("todos:read", app.showTagHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tags/:id", app.requirePermission("todos:write", app.updateTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tags/:id", app.requirePermission("todos:write", app.deleteTagHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags/:id/merge", app.requirePermission("todos:write", app.mergeTagHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("todos:read", app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("todos:write", app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("todos:read", app.showListHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("todos:write", app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("todos:write", app.deleteListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/todoitems", app.requirePermission("todos:read", app.listListTODOItemsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/todoitems", app.requirePermission("todos:write", app.createListTODOItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/apikeys", app.requireUserCredentials(app.listApiKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/apikeys", app.requireUserCredentials(app.createApiKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/apikeys/:id", app.requireUserCredentials(app.deleteApiKeyHandler))
 
-	return router
+	return app.requestID(app.logRequest(app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))))
 }
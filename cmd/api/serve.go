@@ -0,0 +1,106 @@
+// Filename: cmd/api/serve.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The serve() method starts the HTTP server and blocks until it has shut down.
+// On SIGINT or SIGTERM the server stops accepting connections, lets in-flight
+// requests finish and then waits for the background goroutines
+func (app *application) serve() error {
+	// Create HTTP Server
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		ErrorLog:     log.New(app.logger, "", 0),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	// The metrics are served on their own address so that they can be kept
+	// off the public network
+	var metricsSrv *http.Server
+	if app.config.metrics.addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", app.metricsHandler())
+		metricsSrv = &http.Server{
+			Addr:         app.config.metrics.addr,
+			Handler:      mux,
+			ErrorLog:     log.New(app.logger, "", 0),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+	}
+	// Receives the result of the shutdown
+	shutdownError := make(chan error)
+	go func() {
+		// Wait for an interrupt or terminate signal
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		app.logger.PrintInfo("shutting down server", map[string]string{
+			"signal": s.String(),
+		})
+		// Give in-flight requests a deadline to finish
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+		if metricsSrv != nil {
+			err = metricsSrv.Shutdown(ctx)
+			if err != nil {
+				shutdownError <- err
+				return
+			}
+		}
+		// Tell the background loops to stop and wait for every task
+		app.logger.PrintInfo("waiting for background tasks to finish", nil)
+		close(app.done)
+		app.wg.Wait()
+		shutdownError <- nil
+	}()
+	// A metrics server which cannot start is logged but does not stop the API
+	if metricsSrv != nil {
+		app.background(func() {
+			app.logger.PrintInfo("starting metrics server", map[string]string{
+				"addr": metricsSrv.Addr,
+			})
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{"task": "serve metrics"})
+			}
+		})
+	}
+	// Start our Server
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": srv.Addr,
+		"env":  app.config.env,
+	})
+	err := srv.ListenAndServe()
+	// ErrServerClosed means that Shutdown() has been called
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+	app.logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+	return nil
+}
@@ -0,0 +1,180 @@
+// Filename: cmd/api/shares.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The listSharesHandler() returns the users a todo item has been shared with
+// for the "GET" /v1/todoitems/:id/shares" endpoint
+func (app *application) listSharesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the todo item exists
+	_, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	shares, err := app.models.Shares.GetAll(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"shares": shares}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createShareHandler() invites a registered user to a todo item by email
+// address for the "POST" /v1/todoitems/:id/shares" endpoint. Inviting a user
+// who already has access changes their role
+func (app *application) createShareHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	share := &data.Share{
+		TodoID: id,
+		Email:  input.Email,
+		Role:   strings.ToLower(input.Role),
+	}
+	v := validator.New()
+	if data.ValidateShare(v, share); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only owners can share the item
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !todo.IsOwner() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	invitee, err := app.models.Users.GetByEmail(share.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "must belong to a registered user")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if invitee.ID == todo.OwnerID {
+		v.AddError("email", "must not belong to the user who created the todo item")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	share.UserID = invitee.ID
+	share.Name = invitee.Name
+	share.Email = invitee.Email
+	err = app.models.Shares.Upsert(share)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share": share}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteShareHandler() revokes the access a user has to a todo item for
+// the "DELETE" /v1/todoitems/:id/shares" endpoint. Owners can revoke anyone
+// and every user can remove themselves
+func (app *application) deleteShareHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Email string `json:"email"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	invitee, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !todo.IsOwner() && invitee.ID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.Shares.Delete(id, invitee.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "access successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,312 @@
+// Filename: cmd/api/tags.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// createTagHandler for the "POST" /v1/tags" endpoint
+func (app *application) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	// Our Target decode destination
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	tag := &data.Tag{
+		OwnerID: app.contextGetUser(r).ID,
+		Name:    input.Name,
+	}
+	// initialize a new Validator instance
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Create a Tag Object
+	err = app.models.Tags.Insert(tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Create a location header for the newly created tag
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tags/%d", tag.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"tag": tag}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTagHandler for the "GET" /v1/tags/:id" endpoint
+func (app *application) showTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	tag, err := app.models.Tags.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTagHandler for the "PATCH" /v1/tags/:id" endpoint renames a tag
+func (app *application) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Fetch the original record from the database
+	tag, err := app.models.Tags.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Name *string `json:"name"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Tags.Update(tag, user.ID, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists, merge the tags instead")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTagHandler for the "DELETE" /v1/tags/:id" endpoint
+func (app *application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Tags.Delete(id, user.ID, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTagsHandler for the "GET" /v1/tags" endpoint
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Name = app.readString(qs, "name", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortList = []string{"id", "name", "-id", "-name"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tags, metadata, err := app.models.Tags.GetAll(user.ID, input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeTagHandler for the "POST" /v1/tags/:id/merge" endpoint moves every
+// todo item from this tag onto the "into" tag and removes this tag
+func (app *application) mergeTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Into int64 `json:"into"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != id, "into", "must not be the tag being merged")
+	if v.Valid() {
+		_, err = app.models.Tags.Get(input.Into, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("into", "must reference an existing tag")
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tag, err := app.models.Tags.Merge(id, input.Into, user.ID, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// attachTagsHandler for the "POST" /v1/todoitems/:id/tags" endpoint
+func (app *application) attachTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	app.changeTags(w, r, func(todoID int64, names []string, actor string) error {
+		return app.models.Tags.Attach(todoID, names, user.ID, actor)
+	})
+}
+
+// detachTagsHandler for the "DELETE" /v1/todoitems/:id/tags" endpoint
+func (app *application) detachTagsHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeTags(w, r, app.models.Tags.Detach)
+}
+
+// The changeTags() method reads a list of tag names for a todo item, applies
+// the change and responds with the updated todo item
+func (app *application) changeTags(w http.ResponseWriter, r *http.Request, change func(int64, []string, string) error) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTagNames(v, input.Tags); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Make sure the todo item exists and the user can edit it
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !todo.CanEdit() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = change(id, input.Tags, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownTag):
+			v.AddError("tags", "must name existing tags of the todo item's owner, only the owner can create new tags")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Fetch the item again so the response carries the new tags and version
+	todo, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"todo.osborncollins.net/internal/data"
 	"todo.osborncollins.net/internal/validator"
@@ -13,17 +15,28 @@ import (
 
 // createTODOItemHandler for the "POST" /v1/todoitems" endpoint
 func (app *application) createTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	app.createTODOItem(w, r, nil)
+}
+
+// The createTODOItem() method creates a todo item from the request body. If
+// list is not nil then the item is created in that list
+func (app *application) createTODOItem(w http.ResponseWriter, r *http.Request, list *data.List) {
 	// Our Target decode destination
 	var input struct {
-		Task_Name   string   `json:"task_name"`
-		Description string   `json:"description"`
-		Notes       string   `json:"notes"`
-		Category    string   `json:"category"`
-		Priority    string   `json:"priority"`
-		Status      []string `json:"status"`
+		Task_Name   string     `json:"task_name"`
+		Description string     `json:"description"`
+		Notes       string     `json:"notes"`
+		Category    string     `json:"category"`
+		Priority    string     `json:"priority"`
+		Status      string     `json:"status" form:"csv"`
+		StartAt     *time.Time `json:"start_at"`
+		DueAt       *time.Time `json:"due_at"`
+		Recurrence  string     `json:"recurrence"`
+		ParentID    *int64     `json:"parent_id"`
+		ListID      *int64     `json:"list_id"`
 	}
-	// Initialize a new json.Decoder instance
-	err := app.readJSON(w, r, &input)
+	// Read the JSON or form body
+	err := app.readInput(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -35,27 +48,66 @@ func (app *application) createTODOItemHandler(w http.ResponseWriter, r *http.Req
 		Description: input.Description,
 		Notes:       input.Notes,
 		Category:    input.Category,
-		Priority:    input.Priority,
-		Status:      input.Status,
+		Priority:    data.Priority(strings.ToLower(input.Priority)),
+		StartAt:     input.StartAt,
+		DueAt:       input.DueAt,
+		Recurrence:  input.Recurrence,
+		ParentID:    input.ParentID,
+		ListID:      input.ListID,
+		OwnerID:     app.contextGetUser(r).ID,
+	}
+	// Items without a priority get the lowest level
+	if todo.Priority == "" {
+		todo.Priority = "none"
 	}
 	// initialize a new Validator instance
 	v := validator.New()
-
+	// Forms may send the status more than once or as a comma list
+	input.Status = app.singleStatus(v, input.Status)
+	// Items start in the first status of the workflow unless told otherwise
+	if input.Status == "" {
+		input.Status = app.workflow.Initial
+	}
+	app.workflow.SetStatus(todo, input.Status)
+	// The nested list routes decide the list
+	if list != nil {
+		todo.ListID = &list.ID
+	}
+	data.ValidateTodo(v, todo)
+	v.Check(validator.In(todo.Status, app.workflow.States()...), "status", "must be one of "+strings.Join(app.workflow.States(), ", "))
+	// Make sure the parent item and the list exist
+	err = app.validateParent(v, todo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.validateList(v, todo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	//Check the map to determine if there were any validation errors
-	if data.ValidateTodo(v, todo); !v.Valid() {
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Create a Todo Object
-	err = app.models.Todos.Insert(todo)
+	err = app.models.Todos.Insert(todo, app.actor(r))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Create a location header for the newly created resource/Todo object
+	location := fmt.Sprintf("/v1/todoitems/%d", todo.ID)
+	// Browsers submitting a form are sent on to the new item
+	if app.wantsRedirect(r) {
+		http.Redirect(w, r, location, http.StatusSeeOther)
+		return
+	}
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/todoitems/%d", todo.ID))
+	headers.Set("Location", location)
 	// Write the JSON response with 201 - created status code with the body
 	// being the actual todo data and the header being the headers map
 	err = app.writeJSON(w, http.StatusCreated, envelope{"todo": todo}, headers)
@@ -66,13 +118,27 @@ func (app *application) createTODOItemHandler(w http.ResponseWriter, r *http.Req
 
 // showTODOItemHandlerfor the "GET" /v1/todoitems/:id" endpoint
 func (app *application) showTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
+	// Initialize a validator
+	v := validator.New()
+	// The tree mode nests every subtask beneath the item
+	tree := app.readBool(r.URL.Query(), "tree", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 	// Fetch the specific todo item
-	todo, err := app.models.Todos.Get(id)
+	var todo *data.Todo
+	if tree {
+		todo, err = app.models.Todos.GetTree(id, user.ID)
+	} else {
+		todo, err = app.models.Todos.Get(id, user.ID)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -82,14 +148,26 @@ func (app *application) showTODOItemHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	// List the items this one is waiting on and the items waiting on it
+	blockedBy, err := app.models.Dependencies.GetBlockedBy(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	blocks, err := app.models.Dependencies.GetBlocks(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Write the response by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo, "blocked_by": blockedBy, "blocks": blocks}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) updateTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
 	// This method does a partial replacement
 	// Get the id for the todo item that needs updating
 	id, err := app.readIDParam(r)
@@ -98,7 +176,7 @@ func (app *application) updateTODOItemHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	// Fetch the original record from the database
-	todo, err := app.models.Todos.Get(id)
+	todo, err := app.models.Todos.Get(id, user.ID)
 	// Error handling
 	if err != nil {
 		switch {
@@ -109,25 +187,37 @@ func (app *application) updateTODOItemHandler(w http.ResponseWriter, r *http.Req
 		}
 		return
 	}
+	// Viewers cannot change the item
+	if !todo.CanEdit() {
+		app.notPermittedResponse(w, r)
+		return
+	}
 	// Create an input struct to hold data read in from the client
 	// We update the input struct to use pointers because pointers have a
 	// default value of nil false
 	// if a field remains nil then we know that the client did not update it
 	var input struct {
-		Task_Name   *string  `json:"task_name"`
-		Description *string  `json:"description"`
-		Notes       *string  `json:"notes"`
-		Category    *string  `json:"category"`
-		Priority    *string  `json:"priority"`
-		Status      []string `json:"status"`
+		Task_Name   *string      `json:"task_name"`
+		Description *string      `json:"description"`
+		Notes       *string      `json:"notes"`
+		Category    *string      `json:"category"`
+		Priority    *string      `json:"priority"`
+		Status      *string      `json:"status" form:"csv"`
+		StartAt     optionalTime `json:"start_at"`
+		DueAt       optionalTime `json:"due_at"`
+		Recurrence  *string      `json:"recurrence"`
+		ParentID    *int64       `json:"parent_id"`
+		ListID      *int64       `json:"list_id"`
 	}
 
-	//Initalize a new json.Decoder instance
-	err = app.readJSON(w, r, &input)
+	// Read the JSON or form body
+	err = app.readInput(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	// Keep the original values for the change history
+	prev := *todo
 	// Check for updates
 	if input.Task_Name != nil {
 		todo.Task_Name = *input.Task_Name
@@ -142,34 +232,114 @@ func (app *application) updateTODOItemHandler(w http.ResponseWriter, r *http.Req
 		todo.Category = *input.Category
 	}
 	if input.Priority != nil {
-		todo.Priority = *input.Priority
+		todo.Priority = data.Priority(strings.ToLower(*input.Priority))
 	}
+	// Forms may send the status more than once or as a comma list
 	if input.Status != nil {
-		todo.Status = input.Status
+		v := validator.New()
+		status := app.singleStatus(v, *input.Status)
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		input.Status = &status
+	}
+	// Status changes must follow the workflow
+	if input.Status != nil && *input.Status != todo.Status {
+		if !app.workflow.CanTransition(todo.Status, *input.Status) {
+			app.invalidTransitionResponse(w, r, todo.Status, *input.Status, app.workflow.Allowed(todo.Status))
+			return
+		}
+		app.workflow.SetStatus(todo, *input.Status)
+	}
+	// The dates are cleared by sending null
+	if input.StartAt.Set {
+		todo.StartAt = input.StartAt.Value
+	}
+	if input.DueAt.Set {
+		todo.DueAt = input.DueAt.Value
+	}
+	if input.Recurrence != nil {
+		todo.Recurrence = *input.Recurrence
+	}
+	// A parent_id of 0 moves the item back to the top level
+	if input.ParentID != nil {
+		todo.ParentID = input.ParentID
+		if *input.ParentID == 0 {
+			todo.ParentID = nil
+		}
+	}
+	// A list_id of 0 removes the item from its list
+	if input.ListID != nil {
+		todo.ListID = input.ListID
+		if *input.ListID == 0 {
+			todo.ListID = nil
+		}
 	}
 
 	// Perform Validation on the updated todo item. If validation fails then
 	// we send a 422 - unprocessable entity response to the client
 	// initialize a new Validator instance
 	v := validator.New()
-
+	data.ValidateTodo(v, todo)
+	// Make sure the new parent exists and is not one of the item's subtasks
+	err = app.validateParent(v, todo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Items can only be moved into lists which are not archived
+	if input.ListID != nil {
+		err = app.validateList(v, todo)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 	//Check the map to determine if there were any validation errors
-	if data.ValidateTodo(v, todo); !v.Valid() {
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Pass the update todo record to the Update() method
-	err = app.models.Todos.Update(todo)
+	// Finishing a recurring item creates the next item in its series. An
+	// item which is closed without being done, such as a cancelled one, ends
+	// the series
+	var next *data.Todo
+	if !app.workflow.IsDone(prev.Status) && app.workflow.IsDone(todo.Status) {
+		next = todo.NextOccurrence(app.workflow.Initial)
+	}
+	// Pass the update todo record to the Update() method. The next item is
+	// created in the same transaction
+	if next != nil {
+		err = app.models.Todos.UpdateWithNext(todo, next, user.ID, app.actor(r))
+	} else {
+		err = app.models.Todos.Update(todo, user.ID, app.actor(r))
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrParentCycle):
+			// Another item was moved under this one since it was validated
+			v.AddError("parent_id", "must not be one of the todo item's own subtasks")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusCreated, envelope{"todo": todo}, nil)
+	env := envelope{"todo": todo}
+	if next != nil {
+		// The shares are copied so the user has the same role on the next item
+		next.Role = todo.Role
+		env["next_occurrence"] = next
+	}
+	// Browsers submitting a form are sent back to the item
+	if app.wantsRedirect(r) {
+		http.Redirect(w, r, fmt.Sprintf("/v1/todoitems/%d", todo.ID), http.StatusSeeOther)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -178,17 +348,47 @@ func (app *application) updateTODOItemHandler(w http.ResponseWriter, r *http.Req
 
 // The deleteTODOItemHandler() allows the user to delete a todo item from the databse by using the ID
 func (app *application) deleteTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Delete the todo item from the database. Send a 404 Not Found status code to the
+	// Items with subtasks need an explicit choice of what happens to them
+	v := validator.New()
+	children := app.readString(r.URL.Query(), "children", "")
+	if children != "" {
+		v.Check(validator.In(children, data.ChildrenCascade, data.ChildrenReparent), "children", "must be cascade or reparent")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Make sure the todo item exists
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Only owners can delete the item
+	if !todo.IsOwner() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	// Move the todo item to the trash. Send a 404 Not Found status code to the
 	// client if there is no matching record
-	err = app.models.Todos.Delete(id)
+	err = app.models.Todos.Delete(id, user.ID, children, app.actor(r))
 	// Error handling
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrHasChildren):
+			v.AddError("children", "the todo item has subtasks, must be cascade or reparent")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
@@ -197,7 +397,7 @@ func (app *application) deleteTODOItemHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	// Return 200 Status OK to the client with a success message
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "todo item successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "todo item moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -206,11 +406,27 @@ func (app *application) deleteTODOItemHandler(w http.ResponseWriter, r *http.Req
 // The listTODOItemsHandler() allows the client to see a listing of todo items
 // based on a set criteria
 func (app *application) listTODOItemsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listTODOItems(w, r, 0)
+}
+
+// The listTODOItems() method writes the todo items which match the query
+// string. A listID of 0 lets the client choose the list with "list_id"
+func (app *application) listTODOItems(w http.ResponseWriter, r *http.Request, listID int64) {
+	user := app.contextGetUser(r)
 	// Create an input struct to hold our query parameter
 	var input struct {
-		Task_Name string
-		Priority  string
-		Status    []string
+		Scope       string
+		Task_Name   string
+		Priority    string
+		PriorityGTE string
+		Status      []string
+		DueBefore   *time.Time
+		DueAfter    *time.Time
+		Overdue     bool
+		Blocked     *bool
+		Tags        []string
+		TagsMode    string
+		ListID      int64
 		data.Filters
 	}
 	// Initialize a validator
@@ -218,23 +434,47 @@ func (app *application) listTODOItemsHandler(w http.ResponseWriter, r *http.Requ
 	// Get the URL values map
 	qs := r.URL.Query()
 	// use the helper methods to extract values
+	input.Scope = app.readString(qs, "scope", data.ScopeAll)
+	v.Check(validator.In(input.Scope, data.ScopeMine, data.ScopeShared, data.ScopeAll), "scope", "must be mine, shared or all")
 	input.Task_Name = app.readString(qs, "task_name", "")
-	input.Priority = app.readString(qs, "priority", "")
+	input.Priority = strings.ToLower(app.readString(qs, "priority", ""))
+	input.PriorityGTE = strings.ToLower(app.readString(qs, "priority_gte", ""))
+	if input.Priority != "" {
+		v.Check(validator.In(input.Priority, data.PriorityLevels...), "priority", "must be one of none, low, medium, high or urgent")
+	}
+	if input.PriorityGTE != "" {
+		v.Check(validator.In(input.PriorityGTE, data.PriorityLevels...), "priority_gte", "must be one of none, low, medium, high or urgent")
+	}
 	input.Status = app.readCSV(qs, "status", []string{})
+	input.DueBefore = app.readTime(qs, "due_before", v)
+	input.DueAfter = app.readTime(qs, "due_after", v)
+	input.Overdue = app.readBool(qs, "overdue", false, v)
+	// Leave blocked as nil unless the client asked to filter on it
+	if qs.Has("blocked") {
+		blocked := app.readBool(qs, "blocked", false, v)
+		input.Blocked = &blocked
+	}
+	input.Tags = app.readCSV(qs, "tags", []string{})
+	input.TagsMode = app.readString(qs, "tags_mode", "any")
+	v.Check(validator.In(input.TagsMode, "any", "all"), "tags_mode", "must be any or all")
+	input.ListID = listID
+	if input.ListID == 0 {
+		input.ListID = int64(app.readInt(qs, "list_id", 0, v))
+	}
 	// Get the page information using the read int method
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	// Get the sort information
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Specify the allowed sort values
-	input.Filters.SortList = []string{"id", "task_name", "priority", "-id", "-task_name", "-priority"}
+	input.Filters.SortList = []string{"id", "task_name", "priority", "due_at", "position", "-id", "-task_name", "-priority", "-due_at", "-position"}
 	// Check for validation errors
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Get a listing of all todo items
-	todos, metadata, err := app.models.Todos.GetAll(input.Task_Name, input.Priority, input.Status, input.Filters)
+	todos, metadata, err := app.models.Todos.GetAll(user.ID, input.Scope, input.Task_Name, input.Priority, input.PriorityGTE, input.Status, input.DueBefore, input.DueAfter, input.Overdue, input.Blocked, input.Tags, input.TagsMode, input.ListID, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -246,3 +486,201 @@ func (app *application) listTODOItemsHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 }
+
+// The listTODOItemOccurrencesHandler() previews the upcoming instances of a
+// recurring todo item between the "from" and "to" query parameters
+func (app *application) listTODOItemOccurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Initialize a validator
+	v := validator.New()
+	// Get the URL values map
+	qs := r.URL.Query()
+	// Default to the next 90 days
+	from := app.readTime(qs, "from", v)
+	if from == nil {
+		now := time.Now()
+		from = &now
+	}
+	to := app.readTime(qs, "to", v)
+	if to == nil {
+		end := from.AddDate(0, 0, 90)
+		to = &end
+	}
+	v.Check(!to.Before(*from), "to", "must not be before from")
+	// Check for validation errors
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Fetch the specific todo item
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Limit the preview to 100 occurrences
+	occurrences := todo.Occurrences(*from, *to, 100)
+	err = app.writeJSON(w, http.StatusOK, envelope{"occurrences": occurrences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listTODOItemChildrenHandler() returns the direct subtasks of a todo item
+func (app *application) listTODOItemChildrenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the parent todo item exists
+	_, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	children, err := app.models.Todos.GetChildren(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todos": children}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The validateParent() method checks that the parent of a todo item exists and
+// that the item is not being moved beneath one of its own subtasks
+func (app *application) validateParent(v *validator.Validator, todo *data.Todo) error {
+	if todo.ParentID == nil {
+		return nil
+	}
+	ancestors, err := app.models.Todos.Ancestors(*todo.ParentID, todo.OwnerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must reference an existing todo item")
+			return nil
+		default:
+			return err
+		}
+	}
+	data.ValidateParent(v, todo, ancestors)
+	return nil
+}
+
+// The validateList() method checks that the list of a todo item exists, belongs
+// to the owner of the item and has not been archived
+func (app *application) validateList(v *validator.Validator, todo *data.Todo) error {
+	if todo.ListID == nil {
+		return nil
+	}
+	list, err := app.models.Lists.Get(*todo.ListID, todo.OwnerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("list_id", "must reference an existing list")
+			return nil
+		default:
+			return err
+		}
+	}
+	v.Check(!list.Archived, "list_id", "must not reference an archived list")
+	return nil
+}
+
+// The moveTODOItemHandler() places a todo item directly "before" or "after"
+// another todo item for the "POST" /v1/todoitems/:id/move" endpoint
+func (app *application) moveTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Before int64 `json:"before"`
+		After  int64 `json:"after"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Exactly one of before and after is needed
+	v := validator.New()
+	v.Check(input.Before != 0 || input.After != 0, "before", "either before or after must be provided")
+	v.Check(input.Before == 0 || input.After == 0, "before", "must not be provided together with after")
+	v.Check(input.Before != id, "before", "must not reference the todo item itself")
+	v.Check(input.After != id, "after", "must not reference the todo item itself")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Make sure the todo item exists and the user can edit it
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !todo.CanEdit() {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.Todos.Move(id, user.ID, input.Before, input.After, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			if input.Before != 0 {
+				v.AddError("before", "must reference an existing todo item")
+			} else {
+				v.AddError("after", "must reference an existing todo item")
+			}
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDifferentList):
+			// Items change list through the update endpoint, where the
+			// list is validated
+			if input.Before != 0 {
+				v.AddError("before", "must reference a todo item in the same list")
+			} else {
+				v.AddError("after", "must reference a todo item in the same list")
+			}
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Fetch the item again so the response carries its new position
+	todo, err = app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
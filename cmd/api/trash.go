@@ -0,0 +1,95 @@
+// Filename: cmd/api/trash.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo.osborncollins.net/internal/data"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The listTrashHandler() returns the todo items in the trash, most recently
+// deleted first
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The trash is always ordered by deletion time
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortList = []string{"-deleted_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	todos, metadata, err := app.models.Todos.GetTrash(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todos": todos, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The restoreTODOItemHandler() takes a todo item and the subtasks deleted
+// along with it out of the trash
+func (app *application) restoreTODOItemHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Send a 404 Not Found status code if the item is not in the trash
+	err = app.models.Todos.Restore(id, user.ID, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	todo, err := app.models.Todos.Get(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The purgeTrash() method permanently removes todo items which have been in
+// the trash for longer than the configured retention until the server shuts down
+func (app *application) purgeTrash() {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := app.models.Todos.Purge(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task": "purge trash"})
+		} else if purged > 0 {
+			app.logger.PrintInfo("purged todo items from the trash", map[string]string{
+				"purged": strconv.FormatInt(purged, 10),
+			})
+		}
+		select {
+		case <-ticker.C:
+		case <-app.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Filename: internal/data/apikeys.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.osborncollins.net/internal/validator"
+)
+
+// apiKeyPrefix starts every API key so that leaked keys are easy to spot
+const apiKeyPrefix = "tdk_"
+
+// ApiKey is a named, long lived credential for scripts. Only the hash of the
+// key is stored and the plaintext is returned once when the key is created
+type ApiKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry,omitempty"`
+	LastUsedAt  *time.Time  `json:"last_used_at,omitempty"`
+}
+
+// generateApiKey() fills in a random key along with its hash and prefix
+func generateApiKey(key *ApiKey) error {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	key.Plaintext = apiKeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	key.Prefix = key.Plaintext[:len(apiKeyPrefix)+6]
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+	return nil
+}
+
+// ValidateApiKey() checks a new key. The permissions must be a subset of
+// the permissions the user holds
+func ValidateApiKey(v *validator.Validator, key *ApiKey, granted Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain atleast 1 entry")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate entries")
+	for _, code := range key.Permissions {
+		v.Check(granted.Include(code), "permissions", "must only contain permissions you hold")
+	}
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// ValidateApiKeyPlaintext() checks that a key looks like one we issued
+func ValidateApiKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(strings.HasPrefix(keyPlaintext, apiKeyPrefix), "key", "must be a valid API key")
+	v.Check(len(keyPlaintext) == len(apiKeyPrefix)+32, "key", "must be a valid API key")
+}
+
+// Define an ApiKeyModel which wraps a sql.DB connection pool
+type ApiKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert() generates a new key and stores it
+func (m ApiKeyModel) Insert(key *ApiKey) error {
+	err := generateApiKey(key)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	args := []interface{}{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), key.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser() returns the keys of a user, newest first
+func (m ApiKeyModel) GetAllForUser(userID int64) ([]*ApiKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []*ApiKey{}
+	for rows.Next() {
+		var key ApiKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array((*[]string)(&key.Permissions)),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Delete() revokes a key belonging to a user
+func (m ApiKeyModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	results, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForKey() returns an unexpired key and the user it belongs to. The time
+// the key was last used is updated at the same time
+func (m ApiKeyModel) GetForKey(keyPlaintext string) (*ApiKey, *User, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+	query := `
+		WITH used AS (
+			UPDATE api_keys
+			SET last_used_at = NOW()
+			WHERE hash = $1
+			AND (expiry IS NULL OR expiry > NOW())
+			RETURNING id, created_at, user_id, name, prefix, permissions, expiry, last_used_at
+		)
+		SELECT used.id, used.created_at, used.user_id, used.name, used.prefix, used.permissions, used.expiry, used.last_used_at,
+		users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		FROM used
+		INNER JOIN users ON users.id = used.user_id
+	`
+	var key ApiKey
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:]).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array((*[]string)(&key.Permissions)),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	return &key, &user, nil
+}
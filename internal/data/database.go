@@ -0,0 +1,55 @@
+// Filename: internal/data/database.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Migration describes the schema version recorded by the migrate tool
+type Migration struct {
+	Version int64 `json:"version"`
+	Dirty   bool  `json:"dirty"`
+}
+
+// Define a DatabaseModel which reports on the state of the database
+type DatabaseModel struct {
+	DB *sql.DB
+}
+
+// Ping() checks that the database can be reached
+func (m DatabaseModel) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.PingContext(ctx)
+}
+
+// Stats() returns the statistics of the connection pool
+func (m DatabaseModel) Stats() sql.DBStats {
+	return m.DB.Stats()
+}
+
+// Migration() returns the version of the last migration which was applied
+func (m DatabaseModel) Migration() (*Migration, error) {
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var migration Migration
+	err := m.DB.QueryRowContext(ctx, query).Scan(&migration.Version, &migration.Dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &migration, nil
+}
@@ -0,0 +1,229 @@
+// Filename: internal/data/dependencies.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// dependencyLockKey is the advisory lock which serializes changes to the
+// dependency graph. Without it two inserts such as A->B and B->A could both
+// pass the cycle check
+const dependencyLockKey = 7142001
+
+// Define a DependencyModel which wraps a sql.DB connection pool. A dependency
+// records that a todo item cannot start until another item is done
+type DependencyModel struct {
+	DB *sql.DB
+}
+
+// Insert() records that todoID depends on dependsOnID. The user must be able
+// to see dependsOnID, otherwise ErrRecordNotFound is returned. It returns
+// ErrDependencyCycle if dependsOnID already depends on todoID
+func (m DependencyModel) Insert(todoID, dependsOnID int64, userID int64) error {
+	if todoID == dependsOnID {
+		return ErrDependencyCycle
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+	// The cycle check and the insert happen together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Hold the lock until the transaction ends
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, dependencyLockKey)
+	if err != nil {
+		return err
+	}
+	// The other item could have been trashed or unshared since it was checked
+	query := `
+		SELECT EXISTS(SELECT 1 FROM todotbl WHERE id = $1 AND ` + roleFor("$2") + ` IS NOT NULL AND deleted_at IS NULL)
+	`
+	var visible bool
+	err = tx.QueryRowContext(ctx, query, dependsOnID, userID).Scan(&visible)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return ErrRecordNotFound
+	}
+	// Walk everything dependsOnID is waiting on to see if todoID is among them
+	query = `
+		WITH RECURSIVE upstream AS (
+			SELECT depends_on_id FROM todo_dependencies WHERE todo_id = $1
+			UNION
+			SELECT d.depends_on_id FROM todo_dependencies d JOIN upstream u ON d.todo_id = u.depends_on_id
+		)
+		SELECT EXISTS(SELECT 1 FROM upstream WHERE depends_on_id = $2)
+	`
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, dependsOnID, todoID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+	query = `
+		INSERT INTO todo_dependencies (todo_id, depends_on_id)
+		VALUES ($1, $2)
+	`
+	_, err = tx.ExecContext(ctx, query, todoID, dependsOnID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "todo_dependencies_pkey"`:
+			return ErrDuplicateDependency
+		default:
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete() removes the dependency of todoID on dependsOnID
+func (m DependencyModel) Delete(todoID, dependsOnID int64) error {
+	query := `
+		DELETE FROM todo_dependencies
+		WHERE todo_id = $1 AND depends_on_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	results, err := m.DB.ExecContext(ctx, query, todoID, dependsOnID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetBlockedBy() returns the IDs of the items which todoID depends on. Only
+// the items which the user can see are included
+func (m DependencyModel) GetBlockedBy(todoID int64, userID int64) ([]int64, error) {
+	query := `
+		SELECT d.depends_on_id
+		FROM todo_dependencies d JOIN todotbl ON todotbl.id = d.depends_on_id
+		WHERE d.todo_id = $1
+		AND todotbl.deleted_at IS NULL
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		ORDER BY d.depends_on_id ASC
+	`
+	return m.queryIDs(query, todoID, userID)
+}
+
+// GetBlocks() returns the IDs of the items which depend on todoID. Only the
+// items which the user can see are included
+func (m DependencyModel) GetBlocks(todoID int64, userID int64) ([]int64, error) {
+	query := `
+		SELECT d.todo_id
+		FROM todo_dependencies d JOIN todotbl ON todotbl.id = d.todo_id
+		WHERE d.depends_on_id = $1
+		AND todotbl.deleted_at IS NULL
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		ORDER BY d.todo_id ASC
+	`
+	return m.queryIDs(query, todoID, userID)
+}
+
+// CriticalPath() returns the longest chain of dependencies which leads up to
+// todoID. The chain starts with the earliest prerequisite and ends with todoID.
+// Items in the trash and items which the user cannot see are left out of the
+// chain
+func (m DependencyModel) CriticalPath(todoID int64, userID int64) ([]int64, error) {
+	query := `
+		WITH RECURSIVE upstream AS (
+			SELECT d.todo_id, d.depends_on_id FROM todo_dependencies d JOIN todotbl ON todotbl.id = d.depends_on_id
+			WHERE d.todo_id = $1 AND todotbl.deleted_at IS NULL AND ` + roleFor("$2") + ` IS NOT NULL
+			UNION
+			SELECT d.todo_id, d.depends_on_id FROM todo_dependencies d JOIN upstream u ON d.todo_id = u.depends_on_id
+			JOIN todotbl ON todotbl.id = d.depends_on_id
+			WHERE todotbl.deleted_at IS NULL AND ` + roleFor("$2") + ` IS NOT NULL
+		)
+		SELECT todo_id, depends_on_id FROM upstream
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	// Build a map of each item to the items it depends on
+	edges := make(map[int64][]int64)
+	for rows.Next() {
+		var from, to int64
+		if err := rows.Scan(&from, &to); err != nil {
+			return nil, err
+		}
+		edges[from] = append(edges[from], to)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// The dependencies form a DAG so the longest path into each item can be
+	// memoized. Ties are broken by the lowest ID. Reaching an item which is
+	// still being walked means the graph has a cycle
+	longest := make(map[int64][]int64)
+	inProgress := make(map[int64]bool)
+	var walk func(id int64) ([]int64, error)
+	walk = func(id int64) ([]int64, error) {
+		if path, ok := longest[id]; ok {
+			return path, nil
+		}
+		if inProgress[id] {
+			return nil, ErrDependencyCycle
+		}
+		inProgress[id] = true
+		deps := edges[id]
+		sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
+		var best []int64
+		for _, dep := range deps {
+			path, err := walk(dep)
+			if err != nil {
+				return nil, err
+			}
+			if len(path) > len(best) {
+				best = path
+			}
+		}
+		delete(inProgress, id)
+		path := append(append([]int64{}, best...), id)
+		longest[id] = path
+		return path, nil
+	}
+	return walk(todoID)
+}
+
+// The queryIDs() method runs a query which selects a single ID column
+func (m DependencyModel) queryIDs(query string, args ...interface{}) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,189 @@
+// Filename: internal/data/lists.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"todo.osborncollins.net/internal/validator"
+)
+
+type List struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	OwnerID   int64     `json:"-"`
+	Name      string    `json:"name"`
+	Archived  bool      `json:"archived"`
+	ItemCount int       `json:"item_count"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	// Name validation
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+// Define a ListModel which wraps a sql.DB connection pool
+type ListModel struct {
+	DB *sql.DB
+}
+
+// listColumns lists the columns selected for a list
+const listColumns = `id, created_at, name, archived,
+		(SELECT COUNT(*) FROM todotbl t WHERE t.list_id = lists.id AND t.deleted_at IS NULL) AS item_count,
+		version`
+
+// listFields() returns the scan destinations which match listColumns
+func listFields(list *List) []interface{} {
+	return []interface{}{
+		&list.ID,
+		&list.CreatedAt,
+		&list.Name,
+		&list.Archived,
+		&list.ItemCount,
+		&list.Version,
+	}
+}
+
+// Insert() allows us to create a new list owned by list.OwnerID
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (owner_id, name, archived)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []interface{}{list.OwnerID, list.Name, list.Archived}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_owner_id_name_key"`:
+			return ErrDuplicateList
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific list owned by the user
+func (m ListModel) Get(id int64, userID int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE id = $1
+		AND owner_id = $2
+	`
+	list := List{OwnerID: userID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(listFields(&list)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+// GetAll() returns the user's lists whose name contains the given text.
+// Archived lists are only returned when archived is true
+func (m ListModel) GetAll(userID int64, name string, archived bool, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM lists
+		WHERE owner_id = $1
+		AND (name ILIKE '%%' || $2 || '%%' OR $2 = '')
+		AND archived = $3
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`, listColumns, filters.sortColumn(), filters.sortOrder())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []interface{}{userID, name, archived, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	lists := []*List{}
+	for rows.Next() {
+		list := List{OwnerID: userID}
+		err := rows.Scan(append([]interface{}{&totalRecords}, listFields(&list)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return lists, metadata, nil
+}
+
+// Update() allows the owner to rename or archive a list
+func (m ListModel) Update(list *List, userID int64) error {
+	query := `
+		UPDATE lists
+		SET name = $1, archived = $2, version = version + 1
+		WHERE id = $3
+		AND version = $4
+		AND owner_id = $5
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []interface{}{list.Name, list.Archived, list.ID, list.Version, userID}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_owner_id_name_key"`:
+			return ErrDuplicateList
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific list. Its todo items, including those in the
+// trash, are kept but no longer belong to a list. Only the owner can delete it
+func (m ListModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM lists
+		WHERE id = $1
+		AND owner_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	results, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
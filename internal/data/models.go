@@ -8,19 +8,48 @@ import (
 )
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordNotFound      = errors.New("record not found")
+	ErrEditConflict        = errors.New("edit conflict")
+	ErrHasChildren         = errors.New("record has children")
+	ErrDependencyCycle     = errors.New("dependency cycle")
+	ErrParentCycle         = errors.New("parent cycle")
+	ErrDuplicateDependency = errors.New("duplicate dependency")
+	ErrDuplicateTag        = errors.New("duplicate tag")
+	ErrUnknownTag          = errors.New("unknown tag")
+	ErrDuplicateList       = errors.New("duplicate list")
+	ErrDuplicateEmail      = errors.New("duplicate email")
+	ErrDifferentList       = errors.New("different list")
 )
 
 // Create a Wrapper for our data models
 
 type Models struct {
-	Todos TodoModel
+	Todos        TodoModel
+	Dependencies DependencyModel
+	Tags         TagModel
+	Lists        ListModel
+	Revisions    RevisionModel
+	Users        UserModel
+	Tokens       TokenModel
+	Permissions  PermissionModel
+	Shares       ShareModel
+	ApiKeys      ApiKeyModel
+	Database     DatabaseModel
 }
 
 // NewModels() allows us to create a new Models
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Todos: TodoModel{DB: db},
+		Todos:        TodoModel{DB: db, Done: DefaultWorkflow.Done},
+		Dependencies: DependencyModel{DB: db},
+		Tags:         TagModel{DB: db},
+		Lists:        ListModel{DB: db},
+		Revisions:    RevisionModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		Shares:       ShareModel{DB: db},
+		ApiKeys:      ApiKeyModel{DB: db},
+		Database:     DatabaseModel{DB: db},
 	}
 }
@@ -0,0 +1,45 @@
+// Filename: internal/data/priority.go
+
+package data
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// PriorityLevels lists the priorities from lowest to highest. A priority is
+// stored as its index in this list so that sorting follows the levels
+var PriorityLevels = []string{"none", "low", "medium", "high", "urgent"}
+
+// Priority is the name of one of the PriorityLevels
+type Priority string
+
+// PriorityRank() returns the ordinal of a priority level or -1 if the level
+// is unknown
+func PriorityRank(name string) int {
+	for i, level := range PriorityLevels {
+		if name == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// The Value() method stores the priority as its ordinal
+func (p Priority) Value() (driver.Value, error) {
+	rank := PriorityRank(string(p))
+	if rank < 0 {
+		return nil, fmt.Errorf("invalid priority %q", string(p))
+	}
+	return int64(rank), nil
+}
+
+// The Scan() method reads an ordinal back into the priority name
+func (p *Priority) Scan(src interface{}) error {
+	rank, ok := src.(int64)
+	if !ok || rank < 0 || rank >= int64(len(PriorityLevels)) {
+		return fmt.Errorf("cannot scan %v into a priority", src)
+	}
+	*p = Priority(PriorityLevels[rank])
+	return nil
+}
@@ -0,0 +1,66 @@
+// Filename: internal/data/rank.go
+
+package data
+
+import "strings"
+
+// Ranks are strings over rankDigits which sort lexicographically in the same
+// order as the digits, so that a new rank can always be found between two others
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxRankLength is the length past which the ranks of a list are rebalanced
+const maxRankLength = 24
+
+// rankBetween() returns a rank which sorts strictly between a and b. An empty
+// a means the start of the list and an empty b means the end of the list.
+// The result never ends in the lowest digit so there is always room before it
+func rankBetween(a, b string) string {
+	rank := []byte{}
+	upperOpen := b == ""
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(a) {
+			lo = strings.IndexByte(rankDigits, a[i])
+		}
+		hi := len(rankDigits)
+		if !upperOpen && i < len(b) {
+			hi = strings.IndexByte(rankDigits, b[i])
+		}
+		// Copy the common prefix
+		if lo == hi {
+			rank = append(rank, rankDigits[lo])
+			continue
+		}
+		mid := (lo + hi) / 2
+		if mid > lo {
+			return string(append(rank, rankDigits[mid]))
+		}
+		// lo and hi are adjacent so keep lo and look for room in the next
+		// digit, where anything sorts before b
+		rank = append(rank, rankDigits[lo])
+		upperOpen = true
+	}
+}
+
+// evenRanks() returns n ranks which are spread evenly over the smallest
+// number of digits that can hold them
+func evenRanks(n int) []string {
+	base := len(rankDigits)
+	width, capacity := 1, base
+	for capacity <= n {
+		width++
+		capacity *= base
+	}
+	step := capacity / (n + 1)
+	ranks := make([]string, n)
+	for i := range ranks {
+		value := (i + 1) * step
+		digits := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = rankDigits[value%base]
+			value /= base
+		}
+		ranks[i] = strings.TrimRight(string(digits), rankDigits[:1])
+	}
+	return ranks
+}
@@ -0,0 +1,243 @@
+// Filename: internal/data/recurrence.go
+
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The supported recurrence frequencies
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// maxRecurrencePeriods guards against schedules which never produce a match
+const maxRecurrencePeriods = 10000
+
+// The iCalendar two letter weekday codes
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Recurrence describes a repeating schedule using a subset of the iCalendar
+// RRULE syntax, e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10"
+type Recurrence struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Until    *time.Time
+	Count    int
+}
+
+// ParseRecurrence() converts an RRULE string into a Recurrence
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	r := &Recurrence{Interval: 1}
+	for _, part := range strings.Split(strings.ToUpper(rule), ";") {
+		if part == "" {
+			continue
+		}
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly && value != FreqYearly {
+				return nil, fmt.Errorf("unsupported FREQ value %q", value)
+			}
+			r.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("INTERVAL must be a positive integer")
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("COUNT must be a positive integer")
+			}
+			r.Count = count
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY value %q", code)
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+	// Check the combination of parts
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("FREQ must be provided")
+	case r.Count > 0 && r.Until != nil:
+		return nil, fmt.Errorf("COUNT and UNTIL must not both be provided")
+	case len(r.ByDay) > 0 && r.Freq != FreqDaily && r.Freq != FreqWeekly:
+		return nil, fmt.Errorf("BYDAY is only supported with DAILY or WEEKLY")
+	}
+	// Keep the weekdays in week order starting on Monday
+	sort.Slice(r.ByDay, func(i, j int) bool {
+		return mondayOffset(r.ByDay[i]) < mondayOffset(r.ByDay[j])
+	})
+	return r, nil
+}
+
+// parseUntil() accepts both the date and the UTC date-time forms of UNTIL
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be in the form YYYYMMDD or YYYYMMDDTHHMMSSZ")
+}
+
+// mondayOffset() returns the number of days between Monday and the weekday
+func mondayOffset(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// The String() method formats the recurrence back into an RRULE string
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = strings.ToUpper(day.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// The iterate() method calls fn for each occurrence of the schedule starting
+// at dtstart until the schedule ends or fn returns false
+func (r *Recurrence) iterate(dtstart time.Time, fn func(time.Time) bool) {
+	n := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, t := range r.candidates(dtstart, period*r.Interval) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return
+			}
+			if r.Count > 0 && n >= r.Count {
+				return
+			}
+			n++
+			if !fn(t) {
+				return
+			}
+		}
+	}
+}
+
+// The candidates() method returns the possible occurrences within the period
+// which lies step units of the frequency after dtstart
+func (r *Recurrence) candidates(dtstart time.Time, step int) []time.Time {
+	switch r.Freq {
+	case FreqDaily:
+		t := dtstart.AddDate(0, 0, step)
+		if len(r.ByDay) > 0 && !r.onDay(t.Weekday()) {
+			return nil
+		}
+		return []time.Time{t}
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{dtstart.AddDate(0, 0, 7*step)}
+		}
+		monday := dtstart.AddDate(0, 0, 7*step-mondayOffset(dtstart.Weekday()))
+		days := make([]time.Time, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = monday.AddDate(0, 0, mondayOffset(day))
+		}
+		return days
+	case FreqMonthly:
+		// Months which do not contain the day of dtstart are skipped
+		t := dtstart.AddDate(0, step, 0)
+		if t.Day() != dtstart.Day() {
+			return nil
+		}
+		return []time.Time{t}
+	case FreqYearly:
+		t := dtstart.AddDate(step, 0, 0)
+		if t.Day() != dtstart.Day() {
+			return nil
+		}
+		return []time.Time{t}
+	}
+	return nil
+}
+
+// The onDay() method checks if the weekday is part of BYDAY
+func (r *Recurrence) onDay(day time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// The Between() method returns at most max occurrences which fall between from and to
+func (r *Recurrence) Between(dtstart, from, to time.Time, max int) []time.Time {
+	times := []time.Time{}
+	r.iterate(dtstart, func(t time.Time) bool {
+		if t.After(to) {
+			return false
+		}
+		if !t.Before(from) {
+			times = append(times, t)
+		}
+		return len(times) < max
+	})
+	return times
+}
+
+// The Next() method returns the first occurrence after dtstart. The boolean
+// is false once the schedule has ended
+func (r *Recurrence) Next(dtstart time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	r.iterate(dtstart, func(t time.Time) bool {
+		if t.After(dtstart) {
+			next, found = t, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
@@ -0,0 +1,281 @@
+// Filename: internal/data/revisions.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The actions which are recorded in the change history of a todo item
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// Revision records the state of a todo item after one change along with the
+// fields which that change touched
+type Revision struct {
+	ID        int64                  `json:"id"`
+	TodoID    int64                  `json:"todo_id"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Snapshot  *Todo                  `json:"snapshot,omitempty"`
+	Actor     string                 `json:"actor"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange holds the value of a field before and after a change
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Diff() compares two states of a todo item field by field using their JSON
+// representation. A nil prev is treated as an empty item
+func Diff(prev, cur *Todo) (map[string]FieldChange, error) {
+	before, err := todoFieldMap(prev)
+	if err != nil {
+		return nil, err
+	}
+	after, err := todoFieldMap(cur)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]FieldChange{}
+	for field := range after {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes[field] = FieldChange{Old: before[field], New: after[field]}
+		}
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = FieldChange{Old: before[field], New: nil}
+		}
+	}
+	return changes, nil
+}
+
+// todoFieldMap() converts a todo item into a map of its JSON fields. The
+// version and the nested subtasks are not part of the item's own state
+func todoFieldMap(todo *Todo) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if todo == nil {
+		return fields, nil
+	}
+	js, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(js, &fields)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "version")
+	delete(fields, "children")
+	return fields, nil
+}
+
+// lockTodos() reads the todo items within the transaction and locks them until
+// it ends, so that the state before a change can be compared with the state
+// after it. Items which do not exist are left out. The progress belongs to
+// the subtasks rather than the item and is not read
+func lockTodos(ctx context.Context, tx *sql.Tx, ids ...int64) (map[int64]*Todo, error) {
+	query := `
+		SELECT ` + todoColumns(nil) + `
+		FROM todotbl
+		WHERE id = ANY($1)
+		ORDER BY id ASC
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	todos := make(map[int64]*Todo)
+	for rows.Next() {
+		var todo Todo
+		if err := rows.Scan(todoFields(&todo)...); err != nil {
+			return nil, err
+		}
+		todo.Progress = nil
+		todos[todo.ID] = &todo
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// recordRevisions() adds a revision to the history of each of the todo items
+// whose version has changed since before was read with lockTodos(). Items
+// missing from before are new. The revisions are written in the transaction
+// of the change so that both are saved or neither is
+func recordRevisions(ctx context.Context, tx *sql.Tx, action string, actor string, before map[int64]*Todo, ids ...int64) error {
+	after, err := lockTodos(ctx, tx, ids...)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		todo, ok := after[id]
+		if !ok {
+			continue
+		}
+		prev := before[id]
+		if prev != nil && prev.Version == todo.Version {
+			continue
+		}
+		changes, err := Diff(prev, todo)
+		if err != nil {
+			return err
+		}
+		revision := &Revision{
+			TodoID:   id,
+			Version:  todo.Version,
+			Action:   action,
+			Changes:  changes,
+			Snapshot: todo,
+			Actor:    actor,
+		}
+		err = insertRevision(ctx, tx, revision)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRevision() records a revision of a todo item within the transaction
+func insertRevision(ctx context.Context, tx *sql.Tx, revision *Revision) error {
+	changes, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO todo_revisions (todo_id, version, action, changes, snapshot, actor)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	args := []interface{}{
+		revision.TodoID,
+		revision.Version,
+		revision.Action,
+		string(changes),
+		string(snapshot),
+		revision.Actor,
+	}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&revision.ID, &revision.CreatedAt)
+}
+
+// Define a RevisionModel which wraps a sql.DB connection pool
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the revision of a todo item at a specific version including
+// the full snapshot of the item
+func (m RevisionModel) Get(todoID int64, version int32) (*Revision, error) {
+	if todoID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, todo_id, version, action, changes, snapshot, actor, created_at
+		FROM todo_revisions
+		WHERE todo_id = $1
+		AND version = $2
+	`
+	var revision Revision
+	var changes, snapshot []byte
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, todoID, version).Scan(
+		&revision.ID,
+		&revision.TodoID,
+		&revision.Version,
+		&revision.Action,
+		&changes,
+		&snapshot,
+		&revision.Actor,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(changes, &revision.Changes)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(snapshot, &revision.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetAll() returns the change history of a todo item, oldest first. The
+// snapshots are left out to keep the listing small
+func (m RevisionModel) GetAll(todoID int64, filters Filters) ([]*Revision, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), id, todo_id, version, action, changes, actor, created_at
+		FROM todo_revisions
+		WHERE todo_id = $1
+		ORDER BY version ASC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	revisions := []*Revision{}
+	for rows.Next() {
+		var revision Revision
+		var changes []byte
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.TodoID,
+			&revision.Version,
+			&revision.Action,
+			&changes,
+			&revision.Actor,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		err = json.Unmarshal(changes, &revision.Changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
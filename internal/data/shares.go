@@ -0,0 +1,137 @@
+// Filename: internal/data/shares.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"todo.osborncollins.net/internal/validator"
+)
+
+// The roles a user can have on a todo item. The user who created an item is
+// always its owner
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// The scopes for listing todo items
+const (
+	ScopeMine   = "mine"
+	ScopeShared = "shared"
+	ScopeAll    = "all"
+)
+
+// roleFor() returns an SQL expression for the role which the user in the
+// placeholder has on the current todotbl row. It is NULL without access
+func roleFor(placeholder string) string {
+	return `(CASE WHEN todotbl.owner_id = ` + placeholder + ` THEN 'owner'
+		ELSE (SELECT s.role FROM todo_shares s WHERE s.todo_id = todotbl.id AND s.user_id = ` + placeholder + `) END)`
+}
+
+// Share describes the access a user has been given to a todo item
+type Share struct {
+	TodoID    int64     `json:"todo_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateShare(v *validator.Validator, share *Share) {
+	ValidateEmail(v, share.Email)
+	v.Check(validator.In(share.Role, RoleViewer, RoleEditor, RoleOwner), "role", "must be viewer, editor or owner")
+}
+
+// The CanEdit() method checks if the role of the requesting user allows
+// changes to the todo item
+func (todo *Todo) CanEdit() bool {
+	return todo.Role == RoleEditor || todo.Role == RoleOwner
+}
+
+// The IsOwner() method checks if the requesting user owns the todo item
+func (todo *Todo) IsOwner() bool {
+	return todo.Role == RoleOwner
+}
+
+// Define a ShareModel which wraps a sql.DB connection pool
+type ShareModel struct {
+	DB *sql.DB
+}
+
+// Upsert() gives a user a role on a todo item, replacing any earlier role
+func (m ShareModel) Upsert(share *Share) error {
+	query := `
+		INSERT INTO todo_shares (todo_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (todo_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, share.TodoID, share.UserID, share.Role).Scan(&share.CreatedAt)
+}
+
+// Delete() revokes the access a user has been given to a todo item
+func (m ShareModel) Delete(todoID int64, userID int64) error {
+	query := `
+		DELETE FROM todo_shares
+		WHERE todo_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	results, err := m.DB.ExecContext(ctx, query, todoID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll() returns the users a todo item has been shared with
+func (m ShareModel) GetAll(todoID int64) ([]*Share, error) {
+	query := `
+		SELECT s.todo_id, s.user_id, u.name, u.email, s.role, s.created_at
+		FROM todo_shares s
+		INNER JOIN users u ON u.id = s.user_id
+		WHERE s.todo_id = $1
+		ORDER BY u.email ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []*Share{}
+	for rows.Next() {
+		var share Share
+		err := rows.Scan(
+			&share.TodoID,
+			&share.UserID,
+			&share.Name,
+			&share.Email,
+			&share.Role,
+			&share.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, &share)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
@@ -0,0 +1,530 @@
+// Filename: internal/data/tags.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.osborncollins.net/internal/validator"
+)
+
+type Tag struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	OwnerID   int64     `json:"-"`
+	Name      string    `json:"name"`
+	ItemCount int       `json:"item_count"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	// Name validation
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(len(tag.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(!strings.Contains(tag.Name, ","), "name", "must not contain commas")
+}
+
+// ValidateTagNames() checks the names used to attach or detach tags
+func ValidateTagNames(v *validator.Validator, names []string) {
+	v.Check(len(names) >= 1, "tags", "must contain atleast 1 entry")
+	v.Check(len(names) <= 20, "tags", "must contain less than 21 entries")
+	v.Check(validator.Unique(names), "tags", "must not contain duplicate entries")
+	for _, name := range names {
+		tag := &Tag{Name: name}
+		tv := validator.New()
+		if ValidateTag(tv, tag); !tv.Valid() {
+			v.AddError("tags", fmt.Sprintf("%q %s", name, tv.Errors["name"]))
+		}
+	}
+}
+
+// Define a TagModel which wraps a sql.DB connection pool
+type TagModel struct {
+	DB *sql.DB
+}
+
+// tagColumns lists the columns selected for a tag
+const tagColumns = `id, created_at, name,
+		(SELECT COUNT(*) FROM todo_tags tt JOIN todotbl t ON t.id = tt.todo_id
+		WHERE tt.tag_id = tags.id AND t.deleted_at IS NULL) AS item_count,
+		version`
+
+// Insert() allows us to create a new tag owned by tag.OwnerID
+func (m TagModel) Insert(tag *Tag) error {
+	query := `
+		INSERT INTO tags (owner_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tag.OwnerID, tag.Name).Scan(&tag.ID, &tag.CreatedAt, &tag.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tags_owner_id_name_key"`:
+			return ErrDuplicateTag
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific tag owned by the user
+func (m TagModel) Get(id int64, userID int64) (*Tag, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE id = $1
+		AND owner_id = $2
+	`
+	tag := Tag{OwnerID: userID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&tag.ID,
+		&tag.CreatedAt,
+		&tag.Name,
+		&tag.ItemCount,
+		&tag.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// GetAll() returns a list of the user's tags whose name contains the given text
+func (m TagModel) GetAll(userID int64, name string, filters Filters) ([]*Tag, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM tags
+		WHERE owner_id = $1
+		AND (name ILIKE '%%' || $2 || '%%' OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, tagColumns, filters.sortColumn(), filters.sortOrder())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	tags := []*Tag{}
+	for rows.Next() {
+		tag := Tag{OwnerID: userID}
+		err := rows.Scan(
+			&totalRecords,
+			&tag.ID,
+			&tag.CreatedAt,
+			&tag.Name,
+			&tag.ItemCount,
+			&tag.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return tags, metadata, nil
+}
+
+// Update() renames a tag owned by the user. The todo items carrying the tag
+// have their version bumped and a revision recorded with the actor in the
+// same transaction since their representation changes
+func (m TagModel) Update(tag *Tag, userID int64, actor string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// A tag which was deleted since it was read is an edit conflict
+	err = lockTags(ctx, tx, userID, tag.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	ids, before, err := lockTaggedTodos(ctx, tx, tag.ID)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE tags
+		SET name = $1, version = version + 1
+		WHERE id = $2
+		AND version = $3
+		AND owner_id = $4
+		RETURNING version
+	`
+	args := []interface{}{tag.Name, tag.ID, tag.Version, userID}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&tag.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tags_owner_id_name_key"`:
+			return ErrDuplicateTag
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	err = touchTodos(ctx, tx, ids...)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, ids...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete() removes a specific tag owned by the user and detaches it from
+// every todo item. The change is recorded in the history of those items with
+// the actor
+func (m TagModel) Delete(id int64, userID int64, actor string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = lockTags(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	ids, before, err := lockTaggedTodos(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	err = touchTodos(ctx, tx, ids...)
+	if err != nil {
+		return err
+	}
+	query := `
+		DELETE FROM tags
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, ids...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Merge() moves every todo item tagged with sourceID over to targetID and then
+// removes the source tag. Both tags must be owned by the user. The change is
+// recorded in the history of the items with the actor. The merged target tag
+// is returned
+func (m TagModel) Merge(sourceID, targetID int64, userID int64, actor string) (*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	err = lockTags(ctx, tx, userID, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	// Bump the items carrying the source tag before the links change. This
+	// includes the items which also carry the target tag, as they lose the
+	// source tag. Items with only the target tag do not change
+	ids, before, err := lockTaggedTodos(ctx, tx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	err = touchTodos(ctx, tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT todo_id, $2 FROM todo_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+		DELETE FROM tags
+		WHERE id = $1
+	`
+	results, err := tx.ExecContext(ctx, query, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+	// Return the target with its new item count
+	query = `
+		UPDATE tags
+		SET version = version + 1
+		WHERE id = $1
+		RETURNING ` + tagColumns
+	tag := Tag{OwnerID: userID}
+	err = tx.QueryRowContext(ctx, query, targetID).Scan(
+		&tag.ID,
+		&tag.CreatedAt,
+		&tag.Name,
+		&tag.ItemCount,
+		&tag.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return &tag, tx.Commit()
+}
+
+// Attach() tags a todo item with each of the names. The tags belong to the
+// owner of the todo item. Tags which do not exist yet are created when the
+// user is the owner, otherwise ErrUnknownTag is returned. The version is only
+// bumped, and the change recorded in the item's history with the actor, when
+// a tag was not already attached
+func (m TagModel) Attach(todoID int64, names []string, userID int64, actor string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := lockTodos(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	todo, ok := before[todoID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	// Editors can only use the tags the owner already has
+	if todo.OwnerID == userID {
+		err = createTags(ctx, tx, todo.OwnerID, names)
+	} else {
+		err = checkTags(ctx, tx, todo.OwnerID, names)
+	}
+	if err != nil {
+		return err
+	}
+	attached, err := attachTags(ctx, tx, todoID, names)
+	if err != nil {
+		return err
+	}
+	if attached == 0 {
+		return tx.Commit()
+	}
+	err = touchTodos(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, todoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Detach() removes each of the named tags from a todo item. The version is
+// only bumped, and the change recorded in the item's history with the actor,
+// when one of the tags was attached
+func (m TagModel) Detach(todoID int64, names []string, actor string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := lockTodos(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	query := `
+		DELETE FROM todo_tags
+		WHERE todo_id = $1
+		AND tag_id IN (
+			SELECT g.id
+			FROM tags g JOIN todotbl t ON t.owner_id = g.owner_id
+			WHERE t.id = $1 AND g.name = ANY($2)
+		)
+	`
+	results, err := tx.ExecContext(ctx, query, todoID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return tx.Commit()
+	}
+	err = touchTodos(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, todoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createTags() creates each of the named tags for the owner unless the owner
+// already has it
+func createTags(ctx context.Context, tx *sql.Tx, ownerID int64, names []string) error {
+	query := `
+		INSERT INTO tags (owner_id, name)
+		SELECT $1, n.name
+		FROM unnest($2::text[]) AS n(name)
+		ON CONFLICT (owner_id, name) DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, ownerID, pq.Array(names))
+	return err
+}
+
+// checkTags() returns ErrUnknownTag unless the owner has every one of the
+// named tags
+func checkTags(ctx context.Context, tx *sql.Tx, ownerID int64, names []string) error {
+	query := `
+		SELECT COUNT(DISTINCT name)
+		FROM tags
+		WHERE owner_id = $1
+		AND name = ANY($2)
+	`
+	var found int
+	err := tx.QueryRowContext(ctx, query, ownerID, pq.Array(names)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(names) {
+		return ErrUnknownTag
+	}
+	return nil
+}
+
+// attachTags() links the named tags of the todo item's owner to the item and
+// returns how many were not attached already. Names the owner has no tag for
+// are skipped
+func attachTags(ctx context.Context, tx *sql.Tx, todoID int64, names []string) (int64, error) {
+	query := `
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT $1, g.id
+		FROM tags g JOIN todotbl t ON t.owner_id = g.owner_id
+		WHERE t.id = $1 AND g.name = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+	results, err := tx.ExecContext(ctx, query, todoID, pq.Array(names))
+	if err != nil {
+		return 0, err
+	}
+	return results.RowsAffected()
+}
+
+// lockTags() locks the tags for the rest of the transaction. It returns
+// ErrRecordNotFound unless the user owns every one of them
+func lockTags(ctx context.Context, tx *sql.Tx, userID int64, ids ...int64) error {
+	query := `
+		SELECT id FROM tags
+		WHERE id = ANY($1)
+		AND owner_id = $2
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if found != len(ids) {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// lockTaggedTodos() locks the todo items carrying the tag and returns their
+// IDs along with their state before the change. Items in the trash are left
+// out, as no revision is recorded for them
+func lockTaggedTodos(ctx context.Context, tx *sql.Tx, tagID int64) ([]int64, map[int64]*Todo, error) {
+	query := `
+		SELECT tt.todo_id
+		FROM todo_tags tt JOIN todotbl t ON t.id = tt.todo_id
+		WHERE tt.tag_id = $1 AND t.deleted_at IS NULL
+		ORDER BY tt.todo_id ASC
+	`
+	ids, err := selectIDs(ctx, tx, query, tagID)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err := lockTodos(ctx, tx, ids...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, before, nil
+}
+
+// touchTodos() bumps the version of each of the todo items
+func touchTodos(ctx context.Context, tx *sql.Tx, ids ...int64) error {
+	query := `
+		UPDATE todotbl
+		SET version = version + 1
+		WHERE id = ANY($1)
+	`
+	_, err := tx.ExecContext(ctx, query, pq.Array(ids))
+	return err
+}
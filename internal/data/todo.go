@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -14,15 +15,99 @@ import (
 )
 
 type Todo struct {
-	ID          int64     `json:"id"`
-	CreatedAt   time.Time `json:"-"`
-	Task_Name   string    `json:"task_name"`
-	Description string    `json:"desription"`
-	Notes       string    `json:"notes"`
-	Category    string    `json:"category"`
-	Priority    string    `json:"priority"`
-	Status      []string  `json:"status"`
-	Version     int32     `json:"version"`
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"-"`
+	OwnerID     int64      `json:"owner_id"`
+	Role        string     `json:"role,omitempty"`
+	Task_Name   string     `json:"task_name"`
+	Description string     `json:"desription"`
+	Notes       string     `json:"notes"`
+	Category    string     `json:"category"`
+	Priority    Priority   `json:"priority"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	StartAt     *time.Time `json:"start_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	ParentID    *int64     `json:"parent_id,omitempty"`
+	Progress    *int       `json:"progress,omitempty"`
+	Children    []*Todo    `json:"children,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ListID      *int64     `json:"list_id,omitempty"`
+	Position    string     `json:"position"`
+	Version     int32      `json:"version"`
+}
+
+// The ways in which the children of a deleted todo item can be handled
+const (
+	ChildrenCascade  = "cascade"
+	ChildrenReparent = "reparent"
+)
+
+// parentLockKey is the advisory lock which serializes changes to the parent
+// of a todo item. Without it two updates such as A under B and B under A
+// could both pass the ancestry check
+const parentLockKey = 7142002
+
+// The columns() method lists the columns selected for a todo item
+func (m TodoModel) columns() string {
+	return todoColumns(m.Done)
+}
+
+// todoColumns() lists the columns selected for a todo item. The progress of
+// a parent item is the percentage of its direct children which are in one of
+// the done statuses. Children which were closed without being done, such as
+// cancelled ones, are left out
+func todoColumns(doneStatuses []string) string {
+	done := make([]string, len(doneStatuses))
+	for i, status := range doneStatuses {
+		done[i] = pq.QuoteLiteral(status)
+	}
+	isDone := "FALSE"
+	if len(done) > 0 {
+		isDone = "c.status IN (" + strings.Join(done, ", ") + ")"
+	}
+	return `id, created_at, owner_id, task_name, description, notes, category, priority, status, completed_at, deleted_at,
+		start_at, due_at, recurrence, parent_id, list_id, position,
+		(SELECT ROUND(100.0 * COUNT(*) FILTER (WHERE ` + isDone + `) /
+		NULLIF(COUNT(*) FILTER (WHERE c.completed_at IS NULL OR ` + isDone + `), 0))::int
+		FROM todotbl c WHERE c.parent_id = todotbl.id AND c.deleted_at IS NULL) AS progress,
+		ARRAY(SELECT tg.name FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.todo_id = todotbl.id ORDER BY tg.name) AS tags,
+		version`
+}
+
+// todoFields() returns the scan destinations which match the columns() method
+func todoFields(todo *Todo) []interface{} {
+	return []interface{}{
+		&todo.ID,
+		&todo.CreatedAt,
+		&todo.OwnerID,
+		&todo.Task_Name,
+		&todo.Description,
+		&todo.Notes,
+		&todo.Category,
+		&todo.Priority,
+		&todo.Status,
+		&todo.CompletedAt,
+		&todo.DeletedAt,
+		&todo.StartAt,
+		&todo.DueAt,
+		&todo.Recurrence,
+		&todo.ParentID,
+		&todo.ListID,
+		&todo.Position,
+		&todo.Progress,
+		pq.Array(&todo.Tags),
+		&todo.Version,
+	}
+}
+
+// Occurrence holds the dates of a single instance of a recurring todo item
+type Occurrence struct {
+	StartAt *time.Time `json:"start_at,omitempty"`
+	DueAt   *time.Time `json:"due_at,omitempty"`
 }
 
 func ValidateTodo(v *validator.Validator, todo *Todo) {
@@ -46,47 +131,187 @@ func ValidateTodo(v *validator.Validator, todo *Todo) {
 
 	// Priority validation
 	v.Check(todo.Priority != "", "priority", "must be provided")
-	v.Check(len(todo.Priority) <= 100, "priority", "must not be more than 100 bytes long")
+	v.Check(validator.In(string(todo.Priority), PriorityLevels...), "priority", "must be one of none, low, medium, high or urgent")
 
 	//Staus validation
-	v.Check(todo.Status != nil, "status", "must be provided")
-	v.Check(len(todo.Status) >= 1, "status", "must contain atleast 1 entry")
-	v.Check(len(todo.Status) <= 5, "status", "must contain less than 6 entries")
-	v.Check(validator.Unique(todo.Status), "status", "must not contain duplicate entries")
+	v.Check(todo.Status != "", "status", "must be provided")
+	v.Check(len(todo.Status) <= 50, "status", "must not be more than 50 bytes long")
+
+	// Due date validation
+	if todo.DueAt != nil && todo.StartAt != nil {
+		v.Check(!todo.DueAt.Before(*todo.StartAt), "due_at", "must not be before start_at")
+	}
+
+	// Recurrence validation
+	if todo.Recurrence != "" {
+		v.Check(len(todo.Recurrence) <= 200, "recurrence", "must not be more than 200 bytes long")
+		if _, err := ParseRecurrence(todo.Recurrence); err != nil {
+			v.AddError("recurrence", err.Error())
+		}
+	}
+
+	// Parent validation
+	if todo.ParentID != nil {
+		v.Check(*todo.ParentID > 0, "parent_id", "must be a positive integer")
+		v.Check(*todo.ParentID != todo.ID, "parent_id", "must not reference the todo item itself")
+	}
+}
+
+// ValidateParent() checks that the new parent of a todo item does not create a
+// cycle. ancestors holds the parent's ID followed by the IDs above it
+func ValidateParent(v *validator.Validator, todo *Todo, ancestors []int64) {
+	for _, id := range ancestors {
+		if id == todo.ID {
+			v.AddError("parent_id", "must not be one of the todo item's own subtasks")
+			return
+		}
+	}
+}
+
+// The anchor() method returns the date which a recurrence is scheduled from.
+// This is the due date, falling back to the start date and then the creation date
+func (todo *Todo) anchor() time.Time {
+	switch {
+	case todo.DueAt != nil:
+		return *todo.DueAt
+	case todo.StartAt != nil:
+		return *todo.StartAt
+	default:
+		return todo.CreatedAt
+	}
+}
+
+// The occurrenceAt() method shifts the dates of the todo item so that its
+// anchor falls on t
+func (todo *Todo) occurrenceAt(t time.Time) Occurrence {
+	offset := t.Sub(todo.anchor())
+	var o Occurrence
+	if todo.StartAt != nil {
+		startAt := todo.StartAt.Add(offset)
+		o.StartAt = &startAt
+	}
+	if todo.DueAt != nil || todo.StartAt == nil {
+		o.DueAt = &t
+	}
+	return o
+}
+
+// The Occurrences() method lists at most max instances of the todo item between
+// from and to. An item without a recurrence occurs once
+func (todo *Todo) Occurrences(from, to time.Time, max int) []Occurrence {
+	occurrences := []Occurrence{}
+	rule, err := ParseRecurrence(todo.Recurrence)
+	if err != nil {
+		anchor := todo.anchor()
+		if !anchor.Before(from) && !anchor.After(to) {
+			occurrences = append(occurrences, todo.occurrenceAt(anchor))
+		}
+		return occurrences
+	}
+	for _, t := range rule.Between(todo.anchor(), from, to, max) {
+		occurrences = append(occurrences, todo.occurrenceAt(t))
+	}
+	return occurrences
+}
+
+// The NextOccurrence() method returns a new todo item in the given status for
+// the next instance of a recurring todo item. It returns nil if the item does
+// not repeat or its schedule has ended
+func (todo *Todo) NextOccurrence(status string) *Todo {
+	rule, err := ParseRecurrence(todo.Recurrence)
+	if err != nil {
+		return nil
+	}
+	next, ok := rule.Next(todo.anchor())
+	if !ok {
+		return nil
+	}
+	// The remaining count carries over to the next item in the series
+	if rule.Count > 0 {
+		rule.Count--
+	}
+	o := todo.occurrenceAt(next)
+	return &Todo{
+		Task_Name:   todo.Task_Name,
+		Description: todo.Description,
+		Notes:       todo.Notes,
+		Category:    todo.Category,
+		Priority:    todo.Priority,
+		Status:      status,
+		StartAt:     o.StartAt,
+		DueAt:       o.DueAt,
+		Recurrence:  rule.String(),
+		OwnerID:     todo.OwnerID,
+		ParentID:    todo.ParentID,
+		Tags:        todo.Tags,
+		ListID:      todo.ListID,
+	}
 }
 
-// Define a TodoModel which wraps a sql.DB connection pool
+// Define a TodoModel which wraps a sql.DB connection pool. Done holds the
+// workflow statuses which count towards the progress of a parent item
 type TodoModel struct {
-	DB *sql.DB
+	DB   *sql.DB
+	Done []string
 }
 
-// Insert() allows us to create a new todo item
-func (m TodoModel) Insert(todo *Todo) error {
-	query := `
-	INSERT INTO todotbl (task_name, description, notes, category, priority, status)
-	VALUES ($1, $2, $3, $4, $5, $6)
-	RETURNING id, created_at, version
-	`
+// Insert() allows us to create a new todo item. New items are placed at the
+// end of their list. The actor is recorded in the item's change history
+func (m TodoModel) Insert(todo *Todo, actor string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = m.insert(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionInsert, actor, nil, todo.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The insert() method creates the todo item within the transaction
+func (m TodoModel) insert(ctx context.Context, tx *sql.Tx, todo *Todo) error {
+	var err error
+	// Find the position after the last of the owner's items in the list
+	todo.Position, err = m.positionAtEnd(ctx, tx, todo.OwnerID, todo.ListID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO todotbl (task_name, description, notes, category, priority, status, start_at, due_at, recurrence, parent_id, list_id, position, completed_at, owner_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	RETURNING id, created_at, version
+	`
 	// Collect the data fields into a slice
 	args := []interface{}{todo.Task_Name, todo.Description, todo.Notes,
-		todo.Category, todo.Priority, pq.Array(todo.Status),
+		todo.Category, todo.Priority, todo.Status,
+		todo.StartAt, todo.DueAt, todo.Recurrence, todo.ParentID, todo.ListID,
+		todo.Position, todo.CompletedAt, todo.OwnerID,
 	}
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Version)
+	return tx.QueryRowContext(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Version)
 }
 
-// GET() allows us to retrieve a specific todo item
-func (m TodoModel) Get(id int64) (*Todo, error) {
+// GET() allows us to retrieve a specific todo item which the user owns or
+// which has been shared with them. Role is set to the role of the user
+func (m TodoModel) Get(id int64, userID int64) (*Todo, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	// Create query
 	query := `
-		SELECT id, created_at, task_name, description, notes, category, priority, status, version
+		SELECT ` + m.columns() + `, ` + roleFor("$2") + `
 		FROM todotbl
 		WHERE id = $1
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		AND deleted_at IS NULL
 	`
 	// Declare a Todo variable to hold the return data
 	var todo Todo
@@ -94,17 +319,7 @@ func (m TodoModel) Get(id int64) (*Todo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&todo.ID,
-		&todo.CreatedAt,
-		&todo.Task_Name,
-		&todo.Description,
-		&todo.Notes,
-		&todo.Category,
-		&todo.Priority,
-		pq.Array(&todo.Status),
-		&todo.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(append(todoFields(&todo), &todo.Role)...)
 	// Handle any errors
 	if err != nil {
 		// Check the type of error
@@ -119,34 +334,133 @@ func (m TodoModel) Get(id int64) (*Todo, error) {
 	return &todo, nil
 }
 
-// Update() allows us to edit/alter a todo item in the list
-func (m TodoModel) Update(todo *Todo) error {
+// Update() allows us to edit/alter a todo item in the list. The user must be
+// an editor or an owner of the item. The actor is recorded in the item's
+// change history
+func (m TodoModel) Update(todo *Todo, userID int64, actor string) error {
+	return m.save(todo, nil, userID, RevisionUpdate, actor)
+}
+
+// Revert() saves a todo item whose fields have been put back to an earlier
+// version. It is recorded in the change history as a revert
+func (m TodoModel) Revert(todo *Todo, userID int64, actor string) error {
+	return m.save(todo, nil, userID, RevisionRevert, actor)
+}
+
+// UpdateWithNext() saves the changes to a recurring todo item and creates the
+// next item in its series in the same transaction. The next item carries the
+// tags of the item, and the users the item is shared with get the same role
+// on the next item
+func (m TodoModel) UpdateWithNext(todo *Todo, next *Todo, userID int64, actor string) error {
+	return m.save(todo, next, userID, RevisionUpdate, actor)
+}
+
+// The save() method saves the changes to the todo item, creates next when it
+// is not nil and records both in the change history in one transaction
+func (m TodoModel) save(todo *Todo, next *Todo, userID int64, action string, actor string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := lockTodos(ctx, tx, todo.ID)
+	if err != nil {
+		return err
+	}
+	// The item can only end up under one of its own subtasks when its parent
+	// changes
+	if prev, ok := before[todo.ID]; ok && todo.ParentID != nil && (prev.ParentID == nil || *prev.ParentID != *todo.ParentID) {
+		err = checkParent(ctx, tx, todo)
+		if err != nil {
+			return err
+		}
+	}
+	// An item moved to another list goes to the end of that list, as a new
+	// item would. Its old position means nothing among the new list's items
+	if prev, ok := before[todo.ID]; ok && !sameList(prev.ListID, todo.ListID) {
+		todo.Position, err = m.positionAtEnd(ctx, tx, todo.OwnerID, todo.ListID)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.update(ctx, tx, todo, userID)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, action, actor, before, todo.ID)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return tx.Commit()
+	}
+	err = m.insert(ctx, tx, next)
+	if err != nil {
+		return err
+	}
+	if len(next.Tags) > 0 {
+		_, err = attachTags(ctx, tx, next.ID, next.Tags)
+		if err != nil {
+			return err
+		}
+	}
+	query := `
+		INSERT INTO todo_shares (todo_id, user_id, role)
+		SELECT $2, user_id, role
+		FROM todo_shares
+		WHERE todo_id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, todo.ID, next.ID)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionInsert, actor, nil, next.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The update() method saves the changes to the todo item within the transaction
+func (m TodoModel) update(ctx context.Context, tx *sql.Tx, todo *Todo, userID int64) error {
 	query := `
 		UPDATE todotbl 
 		set task_name = $1, description = $2, 
 		notes = $3, category = $4, 
 		priority = $5, status = $6, 
+		start_at = $7, due_at = $8,
+		recurrence = $9, parent_id = $10, list_id = $11,
+		completed_at = $12, position = $13,
 		version = version + 1
-		WHERE id = $7
-		AND version = $8
+		WHERE id = $14
+		AND version = $15
+		AND ` + roleFor("$16") + ` IN ('editor', 'owner')
+		AND deleted_at IS NULL
 		RETURNING version
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
-
 	args := []interface{}{
 		todo.Task_Name,
 		todo.Description,
 		todo.Notes,
 		todo.Category,
 		todo.Priority,
-		pq.Array(todo.Status),
+		todo.Status,
+		todo.StartAt,
+		todo.DueAt,
+		todo.Recurrence,
+		todo.ParentID,
+		todo.ListID,
+		todo.CompletedAt,
+		todo.Position,
 		todo.ID,
 		todo.Version,
+		userID,
 	}
 	// Check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&todo.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&todo.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -158,22 +472,132 @@ func (m TodoModel) Update(todo *Todo) error {
 	return nil
 }
 
-// Delete() removes a specific todo item from the list
-func (m TodoModel) Delete(id int64) error {
+// checkParent() takes the parent lock for the rest of the transaction and
+// walks up from the new parent of the todo item. It returns ErrParentCycle if
+// the item itself is found, as the item would then be its own ancestor
+func checkParent(ctx context.Context, tx *sql.Tx, todo *Todo) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, parentLockKey)
+	if err != nil {
+		return err
+	}
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id FROM todotbl WHERE id = $1
+			UNION
+			SELECT t.id, t.parent_id FROM todotbl t JOIN chain c ON t.id = c.parent_id
+		)
+		SELECT EXISTS(SELECT 1 FROM chain WHERE id = $2)
+	`
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, *todo.ParentID, todo.ID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrParentCycle
+	}
+	return nil
+}
+
+// Delete() moves a specific todo item to the trash. If the item has subtasks
+// then children must be ChildrenCascade to trash the whole subtree or
+// ChildrenReparent to move the subtasks up to the item's own parent. The user
+// must be an owner of the item. Every item which changes is recorded in its
+// change history with the actor
+func (m TodoModel) Delete(id int64, userID int64, children string, actor string) error {
 	// Ensure that there is a valid id
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	// Create the delete query
-	query := `
-		DELETE FROM todotbl
-		WHERE id = $1
-	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
+	// The subtasks and the item are trashed together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Make sure the user owns the item before touching its subtasks
+	query := `
+		SELECT EXISTS(SELECT 1 FROM todotbl WHERE id = $1 AND ` + roleFor("$2") + ` = 'owner' AND deleted_at IS NULL)
+	`
+	var exists bool
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordNotFound
+	}
+	// Find the subtasks which the choice of children touches
+	var childIDs []int64
+	switch children {
+	case ChildrenCascade:
+		query := `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM todotbl WHERE parent_id = $1
+				UNION
+				SELECT t.id FROM todotbl t JOIN subtree s ON t.parent_id = s.id
+			)
+			SELECT id FROM todotbl
+			WHERE id IN (SELECT id FROM subtree)
+			AND deleted_at IS NULL
+		`
+		childIDs, err = selectIDs(ctx, tx, query, id)
+	case ChildrenReparent:
+		query := `
+			SELECT id FROM todotbl WHERE parent_id = $1
+		`
+		childIDs, err = selectIDs(ctx, tx, query, id)
+	default:
+		query := `
+			SELECT EXISTS(SELECT 1 FROM todotbl WHERE parent_id = $1 AND deleted_at IS NULL)
+		`
+		var hasChildren bool
+		err = tx.QueryRowContext(ctx, query, id).Scan(&hasChildren)
+		if err == nil && hasChildren {
+			err = ErrHasChildren
+		}
+	}
+	if err != nil {
+		return err
+	}
+	before, err := lockTodos(ctx, tx, append([]int64{id}, childIDs...)...)
+	if err != nil {
+		return err
+	}
+	// Deal with the subtasks next
+	switch children {
+	case ChildrenCascade:
+		query := `
+			UPDATE todotbl
+			SET deleted_at = NOW(), version = version + 1
+			WHERE id = ANY($1)
+		`
+		_, err = tx.ExecContext(ctx, query, pq.Array(childIDs))
+	case ChildrenReparent:
+		query := `
+			UPDATE todotbl
+			SET parent_id = (SELECT parent_id FROM todotbl WHERE id = $1),
+			version = version + 1
+			WHERE id = ANY($2)
+		`
+		_, err = tx.ExecContext(ctx, query, id, pq.Array(childIDs))
+	}
+	if err != nil {
+		return err
+	}
+	// Create the trash query. NOW() is fixed for the transaction so the item
+	// and its subtasks share the same deleted_at and can be restored together
+	query = `
+		UPDATE todotbl
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1
+		AND deleted_at IS NULL
+	`
 	// Execute the query
-	results, err := m.DB.ExecContext(ctx, query, id)
+	results, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -187,25 +611,87 @@ func (m TodoModel) Delete(id int64) error {
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
-	return nil
+	// Subtasks which were moved up are updated rather than trashed
+	action := RevisionDelete
+	if children == ChildrenReparent {
+		action = RevisionUpdate
+	}
+	err = recordRevisions(ctx, tx, action, actor, before, childIDs...)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionDelete, actor, before, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// The GetAll() returns a list of all the todo items sorted by ID
-func (m TodoModel) GetAll(task_name string, priority string, status []string, filters Filters) ([]*Todo, Metadata, error) {
+// selectIDs() runs a query which selects a single ID column within the
+// transaction
+func selectIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// The GetAll() returns a list of the todo items a user can see. scope picks
+// the items the user owns (ScopeMine), the items shared with them
+// (ScopeShared) or both (ScopeAll).
+// dueBefore and dueAfter are optional bounds on the due date, and overdue
+// restricts the listing to items which are past due and not yet completed.
+// If blocked is not nil then only items which are (or are not) waiting on an
+// incomplete dependency which the user can see are returned. Items must carry any of the tags, or all
+// of them when tagsMode is "all". A listID of 0 returns items from every list
+// which has not been archived. priority matches a single level while
+// priorityGTE matches that level and every level above it
+func (m TodoModel) GetAll(userID int64, scope string, task_name string, priority string, priorityGTE string, status []string, dueBefore *time.Time, dueAfter *time.Time, overdue bool, blocked *bool, tags []string, tagsMode string, listID int64, filters Filters) ([]*Todo, Metadata, error) {
 	// Construct the query
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, created_at, task_name, description, notes, category, priority, status, version
+		SELECT COUNT(*) OVER(), %s, %s
 		FROM todotbl
-		WHERE (to_tsvector('simple',task_name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (to_tsvector('simple',priority) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		AND (status @> $3 OR $3 = '{}')
+		WHERE (($15 <> 'shared' AND owner_id = $1) OR ($15 <> 'mine' AND EXISTS(
+			SELECT 1 FROM todo_shares s WHERE s.todo_id = todotbl.id AND s.user_id = $1)))
+		AND deleted_at IS NULL
+		AND (to_tsvector('simple',task_name) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (priority = $3 OR $3 < 0)
+		AND priority >= $4
+		AND (status = ANY($5) OR $5 = '{}')
+		AND ($6::timestamptz IS NULL OR due_at < $6)
+		AND ($7::timestamptz IS NULL OR due_at > $7)
+		AND (NOT $8 OR (due_at < NOW() AND completed_at IS NULL))
+		AND ($9::boolean IS NULL OR EXISTS(
+			SELECT 1 FROM todo_dependencies d JOIN todotbl b ON b.id = d.depends_on_id
+			WHERE d.todo_id = todotbl.id AND b.completed_at IS NULL AND b.deleted_at IS NULL
+			AND (b.owner_id = $1 OR EXISTS(SELECT 1 FROM todo_shares s WHERE s.todo_id = b.id AND s.user_id = $1))) = $9)
+		AND ($10 = '{}' OR (
+			SELECT CASE WHEN $11 = 'all' THEN array_agg(tg.name) @> $10 ELSE array_agg(tg.name) && $10 END
+			FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+			WHERE tt.todo_id = todotbl.id))
+		AND (list_id = $12 OR ($12 = 0 AND (list_id IS NULL
+			OR list_id NOT IN (SELECT id FROM lists WHERE archived))))
 		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortOrder())
+		LIMIT $13 OFFSET $14`, m.columns(), roleFor("$1"), filters.sortColumn(), filters.sortOrder())
 
 	// Create a 3-second-timeout context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []interface{}{task_name, priority, pq.Array(status), filters.limit(), filters.offset()}
+	// Unknown or empty priorities have a rank of -1 which matches every level
+	args := []interface{}{userID, task_name, PriorityRank(priority), PriorityRank(priorityGTE), pq.Array(status), dueBefore, dueAfter, overdue, blocked, pq.Array(tags), tagsMode, listID, filters.limit(), filters.offset(), scope}
 	// Execute query
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -220,18 +706,7 @@ func (m TodoModel) GetAll(task_name string, priority string, status []string, fi
 	for rows.Next() {
 		var todo Todo
 		// Scan the values from the row in to the Todo struct
-		err := rows.Scan(
-			&totalRecords,
-			&todo.ID,
-			&todo.CreatedAt,
-			&todo.Task_Name,
-			&todo.Description,
-			&todo.Notes,
-			&todo.Category,
-			&todo.Priority,
-			pq.Array(&todo.Status),
-			&todo.Version,
-		)
+		err := rows.Scan(append(append([]interface{}{&totalRecords}, todoFields(&todo)...), &todo.Role)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -246,3 +721,497 @@ func (m TodoModel) GetAll(task_name string, priority string, status []string, fi
 	// Return the slice of Todos
 	return todos, metadata, nil
 }
+
+// GetChildren() returns the direct subtasks of a todo item which the user
+// can see
+func (m TodoModel) GetChildren(id int64, userID int64) ([]*Todo, error) {
+	query := `
+		SELECT ` + m.columns() + `, ` + roleFor("$2") + `
+		FROM todotbl
+		WHERE parent_id = $1
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		AND deleted_at IS NULL
+		ORDER BY id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	todos := []*Todo{}
+	for rows.Next() {
+		var todo Todo
+		if err := rows.Scan(append(todoFields(&todo), &todo.Role)...); err != nil {
+			return nil, err
+		}
+		todos = append(todos, &todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// GetTree() returns a todo item with all of its subtasks nested beneath it.
+// Only the items which the user can see are included
+func (m TodoModel) GetTree(id int64, userID int64) (*Todo, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM todotbl WHERE id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT t.id FROM todotbl t JOIN subtree s ON t.parent_id = s.id
+			WHERE t.deleted_at IS NULL
+		)
+		SELECT ` + m.columns() + `, ` + roleFor("$2") + `
+		FROM todotbl
+		WHERE id IN (SELECT id FROM subtree)
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		ORDER BY id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	// Keep the rows in order so that children are attached in ID order
+	todos := []*Todo{}
+	byID := make(map[int64]*Todo)
+	for rows.Next() {
+		var todo Todo
+		if err := rows.Scan(append(todoFields(&todo), &todo.Role)...); err != nil {
+			return nil, err
+		}
+		todos = append(todos, &todo)
+		byID[todo.ID] = &todo
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	root, ok := byID[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	for _, todo := range todos {
+		if todo.ID == id || todo.ParentID == nil {
+			continue
+		}
+		if parent, ok := byID[*todo.ParentID]; ok {
+			parent.Children = append(parent.Children, todo)
+		}
+	}
+	return root, nil
+}
+
+// Ancestors() returns the ID of a todo item belonging to a user followed by
+// the IDs of every item above it in the hierarchy
+func (m TodoModel) Ancestors(id int64, userID int64) ([]int64, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM todotbl WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL
+			UNION
+			SELECT t.id, t.parent_id, c.depth + 1 FROM todotbl t JOIN chain c ON t.id = c.parent_id
+			WHERE c.depth < 1000
+		)
+		SELECT id FROM chain
+		ORDER BY depth ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var ancestor int64
+		if err := rows.Scan(&ancestor); err != nil {
+			return nil, err
+		}
+		ids = append(ids, ancestor)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return ids, nil
+}
+
+// Move() places a todo item directly before or directly after another item.
+// Exactly one of beforeID and afterID should be non-zero. Both items must
+// have the same owner and be in the same list, otherwise ErrDifferentList is
+// returned. The user must be able to edit the item and see the item it is
+// placed next to. The actor is recorded in the item's change history
+func (m TodoModel) Move(id int64, userID int64, beforeID int64, afterID int64, actor string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Find the owner and the list of the item being moved
+	var ownerID int64
+	var listID *int64
+	query := `
+		SELECT owner_id, list_id
+		FROM todotbl
+		WHERE id = $1
+		AND ` + roleFor("$2") + ` IN ('editor', 'owner')
+		AND deleted_at IS NULL
+	`
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&ownerID, &listID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	err = lockPositions(ctx, tx, ownerID, listID)
+	if err != nil {
+		return err
+	}
+	before, err := lockTodos(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	// Find the gap between the two items the moved item goes between
+	lo, hi, err := m.positionGap(ctx, tx, id, userID, ownerID, listID, beforeID, afterID)
+	if err != nil {
+		return err
+	}
+	// Spread out the list when the gap has run out of room or the
+	// ranks have grown too long, then look for the gap again
+	position := ""
+	if hi == "" || lo < hi {
+		position = rankBetween(lo, hi)
+	}
+	if position == "" || len(position) > maxRankLength {
+		err = m.rebalance(ctx, tx, ownerID, listID)
+		if err != nil {
+			return err
+		}
+		lo, hi, err = m.positionGap(ctx, tx, id, userID, ownerID, listID, beforeID, afterID)
+		if err != nil {
+			return err
+		}
+		position = rankBetween(lo, hi)
+	}
+	query = `
+		UPDATE todotbl
+		SET position = $1, version = version + 1
+		WHERE id = $2
+	`
+	_, err = tx.ExecContext(ctx, query, position, id)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionUpdate, actor, before, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sameList() reports whether two list IDs refer to the same list, treating
+// no list as a list of its own
+func sameList(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// The lockPositions() function serializes changes to the positions of the
+// owner's items in a list until the transaction ends
+func lockPositions(ctx context.Context, tx *sql.Tx, ownerID int64, listID *int64) error {
+	query := `
+		SELECT pg_advisory_xact_lock(
+			hashtextextended('todo_positions:' || $1::text || ':' || COALESCE($2::bigint::text, ''), 0)
+		)
+	`
+	_, err := tx.ExecContext(ctx, query, ownerID, listID)
+	return err
+}
+
+// The positionGap() method returns the positions on either side of the gap
+// next to the reference item, ignoring the item being moved
+func (m TodoModel) positionGap(ctx context.Context, tx *sql.Tx, id int64, userID int64, ownerID int64, listID *int64, beforeID int64, afterID int64) (string, string, error) {
+	refID := beforeID
+	if refID == 0 {
+		refID = afterID
+	}
+	var refOwnerID int64
+	var refListID *int64
+	var refPosition string
+	query := `
+		SELECT owner_id, list_id, position
+		FROM todotbl
+		WHERE id = $1
+		AND ` + roleFor("$2") + ` IS NOT NULL
+		AND deleted_at IS NULL
+	`
+	err := tx.QueryRowContext(ctx, query, refID, userID).Scan(&refOwnerID, &refListID, &refPosition)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", "", ErrRecordNotFound
+		default:
+			return "", "", err
+		}
+	}
+	// Items are only ordered among the owner's items in the same list
+	if refOwnerID != ownerID || !sameList(refListID, listID) {
+		return "", "", ErrDifferentList
+	}
+	if beforeID != 0 {
+		query = `
+			SELECT COALESCE(MAX(position), '')
+			FROM todotbl
+			WHERE owner_id = $1
+			AND list_id IS NOT DISTINCT FROM $2
+			AND position < $3 AND id <> $4
+		`
+		var lo string
+		err = tx.QueryRowContext(ctx, query, ownerID, listID, refPosition, id).Scan(&lo)
+		return lo, refPosition, err
+	}
+	query = `
+		SELECT COALESCE(MIN(position), '')
+		FROM todotbl
+		WHERE owner_id = $1
+		AND list_id IS NOT DISTINCT FROM $2
+		AND position > $3 AND id <> $4
+	`
+	var hi string
+	err = tx.QueryRowContext(ctx, query, ownerID, listID, refPosition, id).Scan(&hi)
+	return refPosition, hi, err
+}
+
+// The positionAtEnd() method returns a position after the last of the
+// owner's items in a list
+func (m TodoModel) positionAtEnd(ctx context.Context, tx *sql.Tx, ownerID int64, listID *int64) (string, error) {
+	err := lockPositions(ctx, tx, ownerID, listID)
+	if err != nil {
+		return "", err
+	}
+	query := `
+		SELECT COALESCE(MAX(position), '')
+		FROM todotbl
+		WHERE owner_id = $1
+		AND list_id IS NOT DISTINCT FROM $2
+	`
+	var last string
+	err = tx.QueryRowContext(ctx, query, ownerID, listID).Scan(&last)
+	if err != nil {
+		return "", err
+	}
+	position := rankBetween(last, "")
+	if len(position) <= maxRankLength {
+		return position, nil
+	}
+	// Appending has used up the room at the end of the list
+	ranks, err := m.rebalanceRanks(ctx, tx, ownerID, listID, 1)
+	if err != nil {
+		return "", err
+	}
+	return ranks[len(ranks)-1], nil
+}
+
+// The rebalance() method spreads the positions of the owner's items in a
+// list evenly
+func (m TodoModel) rebalance(ctx context.Context, tx *sql.Tx, ownerID int64, listID *int64) error {
+	_, err := m.rebalanceRanks(ctx, tx, ownerID, listID, 0)
+	return err
+}
+
+// The rebalanceRanks() method spreads the positions of the owner's items in a
+// list evenly, leaving room for extra items at the end. The unused ranks are
+// returned. The caller must hold the lock from lockPositions()
+func (m TodoModel) rebalanceRanks(ctx context.Context, tx *sql.Tx, ownerID int64, listID *int64, extra int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM todotbl
+		WHERE owner_id = $1
+		AND list_id IS NOT DISTINCT FROM $2
+		ORDER BY position ASC, id ASC
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, ownerID, listID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	ranks := evenRanks(len(ids) + extra)
+	query = `
+		UPDATE todotbl
+		SET position = $1
+		WHERE id = $2
+	`
+	for i, id := range ids {
+		_, err = tx.ExecContext(ctx, query, ranks[i], id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ranks[len(ids):], nil
+}
+
+// GetTrash() returns the todo items in the trash which the user owns, most
+// recently deleted first
+func (m TodoModel) GetTrash(userID int64, filters Filters) ([]*Todo, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + m.columns() + `
+		FROM todotbl
+		WHERE ` + roleFor("$1") + ` = 'owner'
+		AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id ASC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	todos := []*Todo{}
+	for rows.Next() {
+		var todo Todo
+		err := rows.Scan(append([]interface{}{&totalRecords}, todoFields(&todo)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		todos = append(todos, &todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return todos, metadata, nil
+}
+
+// GetTrashed() returns a specific todo item from the trash which the user owns
+func (m TodoModel) GetTrashed(id int64, userID int64) (*Todo, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + m.columns() + `
+		FROM todotbl
+		WHERE id = $1
+		AND ` + roleFor("$2") + ` = 'owner'
+		AND deleted_at IS NOT NULL
+	`
+	var todo Todo
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(todoFields(&todo)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &todo, nil
+}
+
+// Restore() takes a todo item out of the trash along with any subtasks which
+// were trashed with it. If the item's parent is still in the trash then the
+// item is moved to the top level. Every restored item is recorded in its
+// change history with the actor
+func (m TodoModel) Restore(id int64, userID int64, actor string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id, deleted_at FROM todotbl WHERE id = $1 AND ` + roleFor("$2") + ` = 'owner' AND deleted_at IS NOT NULL
+			UNION
+			SELECT t.id, t.deleted_at FROM todotbl t JOIN subtree s ON t.parent_id = s.id
+			WHERE t.deleted_at = s.deleted_at
+		)
+		SELECT id FROM subtree
+	`
+	ids, err := selectIDs(ctx, tx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return ErrRecordNotFound
+	}
+	before, err := lockTodos(ctx, tx, ids...)
+	if err != nil {
+		return err
+	}
+	query = `
+		UPDATE todotbl
+		SET deleted_at = NULL,
+		parent_id = CASE WHEN todotbl.id = $1 AND EXISTS(
+			SELECT 1 FROM todotbl p WHERE p.id = todotbl.parent_id AND p.deleted_at IS NOT NULL
+		) THEN NULL ELSE todotbl.parent_id END,
+		version = version + 1
+		WHERE id = ANY($2)
+	`
+	_, err = tx.ExecContext(ctx, query, id, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, tx, RevisionRestore, actor, before, ids...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge() permanently removes the todo items which were trashed before the
+// cutoff and returns how many were removed
+func (m TodoModel) Purge(cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM todotbl
+		WHERE deleted_at < $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results, err := m.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return results.RowsAffected()
+}
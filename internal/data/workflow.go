@@ -0,0 +1,132 @@
+// Filename: internal/data/workflow.go
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"todo.osborncollins.net/internal/validator"
+)
+
+// Workflow describes the statuses a todo item can be in and which status
+// changes are allowed. Entering a terminal status closes the item and sets
+// its completed_at. Only the done statuses, which are terminal, mean that
+// the work was finished. They count towards the progress of the parent item
+// and schedule the next occurrence of a recurring item, while an item which
+// is closed without being done, such as a cancelled one, does neither
+type Workflow struct {
+	Initial     string              `json:"initial"`
+	Transitions map[string][]string `json:"transitions"`
+	Terminal    []string            `json:"terminal"`
+	Done        []string            `json:"done"`
+}
+
+// DefaultWorkflow is used when no workflow file is configured
+var DefaultWorkflow = Workflow{
+	Initial: "pending",
+	Transitions: map[string][]string{
+		"pending":     {"in-progress", "completed", "cancelled"},
+		"in-progress": {"pending", "completed", "cancelled"},
+		"completed":   {"pending"},
+		"cancelled":   {"pending"},
+	},
+	Terminal: []string{"completed", "cancelled"},
+	Done:     []string{"completed"},
+}
+
+func ValidateWorkflow(v *validator.Validator, wf *Workflow) {
+	states := wf.States()
+	v.Check(len(states) >= 1, "transitions", "must contain atleast 1 status")
+	v.Check(validator.In(wf.Initial, states...), "initial", "must be one of the statuses in transitions")
+	for from, targets := range wf.Transitions {
+		for _, to := range targets {
+			v.Check(validator.In(to, states...), "transitions", fmt.Sprintf("%q moves to unknown status %q", from, to))
+		}
+	}
+	v.Check(len(wf.Terminal) >= 1, "terminal", "must contain atleast 1 status")
+	for _, state := range wf.Terminal {
+		v.Check(validator.In(state, states...), "terminal", fmt.Sprintf("%q is not one of the statuses in transitions", state))
+	}
+	v.Check(!wf.IsTerminal(wf.Initial), "initial", "must not be a terminal status")
+	v.Check(len(wf.Done) >= 1, "done", "must contain atleast 1 status")
+	for _, state := range wf.Done {
+		v.Check(wf.IsTerminal(state), "done", fmt.Sprintf("%q is not one of the terminal statuses", state))
+	}
+}
+
+// LoadWorkflow() reads and validates a workflow from a JSON file
+func LoadWorkflow(path string) (*Workflow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var wf Workflow
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&wf)
+	if err != nil {
+		return nil, fmt.Errorf("workflow file %s: %w", path, err)
+	}
+	v := validator.New()
+	if ValidateWorkflow(v, &wf); !v.Valid() {
+		problems := []string{}
+		for key, message := range v.Errors {
+			problems = append(problems, key+" "+message)
+		}
+		sort.Strings(problems)
+		return nil, fmt.Errorf("workflow file %s: %s", path, strings.Join(problems, "; "))
+	}
+	return &wf, nil
+}
+
+// The States() method returns every status of the workflow in sorted order
+func (wf *Workflow) States() []string {
+	states := make([]string, 0, len(wf.Transitions))
+	for state := range wf.Transitions {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// The Allowed() method returns the statuses which can follow the given status
+func (wf *Workflow) Allowed(from string) []string {
+	allowed := append([]string{}, wf.Transitions[from]...)
+	sort.Strings(allowed)
+	return allowed
+}
+
+// The CanTransition() method checks if a todo item may move between two statuses
+func (wf *Workflow) CanTransition(from, to string) bool {
+	return validator.In(to, wf.Transitions[from]...)
+}
+
+// The IsTerminal() method checks if a status completes a todo item
+func (wf *Workflow) IsTerminal(state string) bool {
+	return validator.In(state, wf.Terminal...)
+}
+
+// The IsDone() method checks if a status means the work of a todo item was
+// finished
+func (wf *Workflow) IsDone(state string) bool {
+	return validator.In(state, wf.Done...)
+}
+
+// The SetStatus() method moves a todo item to a new status. Entering a
+// terminal status records when the item was completed and leaving one clears it
+func (wf *Workflow) SetStatus(todo *Todo, status string) {
+	todo.Status = status
+	switch {
+	case !wf.IsTerminal(status):
+		todo.CompletedAt = nil
+	case todo.CompletedAt == nil:
+		now := time.Now()
+		todo.CompletedAt = &now
+	}
+}
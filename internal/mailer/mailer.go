@@ -0,0 +1,74 @@
+// Filename: internal/mailer/mailer.go
+
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The email templates are built into the binary
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends emails through an SMTP server
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+// New() creates a Mailer for the SMTP server. No authentication is used when
+// username is empty
+func New(host string, port int, username, password, sender string) Mailer {
+	m := Mailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		sender: sender,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// The Send() method renders the "subject" and "plainBody" templates from
+// templateFile with data and sends the result to recipient
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", m.sender)
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "Subject: %s\r\n", strings.TrimSpace(subject.String()))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.Write(plainBody.Bytes())
+	// Try a few times before giving up on a flaky server
+	for i := 1; i <= 3; i++ {
+		err = smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, msg.Bytes())
+		if err == nil {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,6 @@
+-- Filename: migrations/000004_add_todo_dates.down.sql
+
+DROP INDEX IF EXISTS todotbl_due_at_idx;
+ALTER TABLE todotbl DROP CONSTRAINT IF EXISTS due_at_check;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS due_at;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS start_at;
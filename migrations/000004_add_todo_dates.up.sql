@@ -0,0 +1,6 @@
+-- Filename: migrations/000004_add_todo_dates.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS start_at timestamp(0) with time zone;
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS due_at timestamp(0) with time zone;
+ALTER TABLE todotbl ADD CONSTRAINT due_at_check CHECK (due_at IS NULL OR start_at IS NULL OR due_at >= start_at);
+CREATE INDEX IF NOT EXISTS todotbl_due_at_idx ON todotbl (due_at);
@@ -0,0 +1,3 @@
+-- Filename: migrations/000005_add_todo_recurrence.down.sql
+
+ALTER TABLE todotbl DROP COLUMN IF EXISTS recurrence;
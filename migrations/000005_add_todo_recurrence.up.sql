@@ -0,0 +1,3 @@
+-- Filename: migrations/000005_add_todo_recurrence.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS recurrence text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Filename: migrations/000006_add_todo_parent.down.sql
+
+DROP INDEX IF EXISTS todotbl_parent_id_idx;
+ALTER TABLE todotbl DROP CONSTRAINT IF EXISTS parent_id_check;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,5 @@
+-- Filename: migrations/000006_add_todo_parent.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES todotbl(id) ON DELETE SET NULL;
+ALTER TABLE todotbl ADD CONSTRAINT parent_id_check CHECK (parent_id <> id);
+CREATE INDEX IF NOT EXISTS todotbl_parent_id_idx ON todotbl (parent_id);
@@ -0,0 +1,3 @@
+-- Filename: migrations/000007_create_todo_dependencies_table.down.sql
+
+DROP TABLE IF EXISTS todo_dependencies;
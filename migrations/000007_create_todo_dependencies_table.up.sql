@@ -0,0 +1,11 @@
+-- Filename: migrations/000007_create_todo_dependencies_table.up.sql
+
+CREATE TABLE IF NOT EXISTS todo_dependencies (
+    todo_id bigint NOT NULL REFERENCES todotbl(id) ON DELETE CASCADE,
+    depends_on_id bigint NOT NULL REFERENCES todotbl(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (todo_id, depends_on_id),
+    CONSTRAINT todo_dependencies_self_check CHECK (todo_id <> depends_on_id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_dependencies_depends_on_id_idx ON todo_dependencies (depends_on_id);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000008_create_tags_tables.down.sql
+
+DROP TABLE IF EXISTS todo_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,16 @@
+-- Filename: migrations/000008_create_tags_tables.up.sql
+
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL UNIQUE,
+    version int NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS todo_tags (
+    todo_id bigint NOT NULL REFERENCES todotbl(id) ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_tags_tag_id_idx ON todo_tags (tag_id);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000009_create_lists_table.down.sql
+
+DROP INDEX IF EXISTS todotbl_list_id_idx;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS list_id;
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,12 @@
+-- Filename: migrations/000009_create_lists_table.up.sql
+
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL UNIQUE,
+    archived boolean NOT NULL DEFAULT false,
+    version int NOT NULL DEFAULT 1
+);
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS list_id bigint REFERENCES lists(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS todotbl_list_id_idx ON todotbl (list_id);
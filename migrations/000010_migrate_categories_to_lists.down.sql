@@ -0,0 +1,9 @@
+-- Filename: migrations/000010_migrate_categories_to_lists.down.sql
+
+UPDATE todotbl SET list_id = NULL
+FROM lists
+WHERE lists.id = todotbl.list_id
+AND lists.name = todotbl.category;
+
+DELETE FROM lists
+WHERE NOT EXISTS (SELECT 1 FROM todotbl WHERE todotbl.list_id = lists.id);
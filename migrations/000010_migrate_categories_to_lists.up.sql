@@ -0,0 +1,11 @@
+-- Filename: migrations/000010_migrate_categories_to_lists.up.sql
+
+INSERT INTO lists (name)
+SELECT DISTINCT category FROM todotbl
+WHERE category <> ''
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE todotbl SET list_id = lists.id
+FROM lists
+WHERE lists.name = todotbl.category
+AND todotbl.list_id IS NULL;
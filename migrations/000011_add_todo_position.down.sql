@@ -0,0 +1,4 @@
+-- Filename: migrations/000011_add_todo_position.down.sql
+
+DROP INDEX IF EXISTS todotbl_list_id_position_idx;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS position;
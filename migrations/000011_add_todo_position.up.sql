@@ -0,0 +1,12 @@
+-- Filename: migrations/000011_add_todo_position.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS position text COLLATE "C" NOT NULL DEFAULT '';
+
+UPDATE todotbl SET position = ranked.position
+FROM (
+    SELECT id, lpad((row_number() OVER (PARTITION BY list_id ORDER BY id))::text, 10, '0') AS position
+    FROM todotbl
+) AS ranked
+WHERE todotbl.id = ranked.id;
+
+CREATE INDEX IF NOT EXISTS todotbl_list_id_position_idx ON todotbl (list_id, position);
@@ -0,0 +1,11 @@
+-- Filename: migrations/000012_convert_priority_to_levels.down.sql
+
+DROP INDEX IF EXISTS todotbl_priority_idx;
+ALTER TABLE todotbl DROP CONSTRAINT IF EXISTS priority_level_check;
+ALTER TABLE todotbl ALTER COLUMN priority DROP DEFAULT;
+
+ALTER TABLE todotbl ALTER COLUMN priority TYPE text USING (
+    (ARRAY['None', 'Low', 'Medium', 'High', 'Urgent'])[priority + 1]
+);
+
+CREATE INDEX IF NOT EXISTS todotbl_priority_idx ON todotbl USING GIN(to_tsvector('simple', priority));
@@ -0,0 +1,17 @@
+-- Filename: migrations/000012_convert_priority_to_levels.up.sql
+
+DROP INDEX IF EXISTS todotbl_priority_idx;
+
+ALTER TABLE todotbl ALTER COLUMN priority TYPE smallint USING (
+    CASE lower(trim(priority))
+        WHEN 'low' THEN 1
+        WHEN 'medium' THEN 2
+        WHEN 'high' THEN 3
+        WHEN 'urgent' THEN 4
+        ELSE 0
+    END
+);
+ALTER TABLE todotbl ALTER COLUMN priority SET DEFAULT 0;
+ALTER TABLE todotbl ADD CONSTRAINT priority_level_check CHECK (priority BETWEEN 0 AND 4);
+
+CREATE INDEX IF NOT EXISTS todotbl_priority_idx ON todotbl (priority);
@@ -0,0 +1,9 @@
+-- Filename: migrations/000013_convert_status_to_workflow.down.sql
+
+DROP INDEX IF EXISTS todotbl_status_idx;
+ALTER TABLE todotbl ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE todotbl ALTER COLUMN status TYPE text[] USING (ARRAY[status]);
+ALTER TABLE todotbl DROP COLUMN IF EXISTS completed_at;
+
+ALTER TABLE todotbl ADD CONSTRAINT status_length_check CHECK (array_length(status, 1) BETWEEN 1 AND 5);
+CREATE INDEX IF NOT EXISTS todotbl_status_idx ON todotbl USING GIN(status);
@@ -0,0 +1,21 @@
+-- Filename: migrations/000013_convert_status_to_workflow.up.sql
+
+ALTER TABLE todotbl DROP CONSTRAINT IF EXISTS status_length_check;
+DROP INDEX IF EXISTS todotbl_status_idx;
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS completed_at timestamp(0) with time zone;
+UPDATE todotbl SET completed_at = NOW()
+WHERE 'completed' = ANY(status) OR 'cancelled' = ANY(status);
+
+-- Keep the furthest status an item had reached
+ALTER TABLE todotbl ALTER COLUMN status TYPE text USING (
+    CASE
+        WHEN 'completed' = ANY(status) THEN 'completed'
+        WHEN 'cancelled' = ANY(status) THEN 'cancelled'
+        WHEN 'in-progress' = ANY(status) THEN 'in-progress'
+        ELSE 'pending'
+    END
+);
+ALTER TABLE todotbl ALTER COLUMN status SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS todotbl_status_idx ON todotbl (status);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000014_add_todo_deleted_at.down.sql
+
+-- Items in the trash become visible again once the column is gone
+DROP INDEX IF EXISTS todotbl_deleted_at_idx;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS deleted_at;
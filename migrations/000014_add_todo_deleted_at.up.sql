@@ -0,0 +1,5 @@
+-- Filename: migrations/000014_add_todo_deleted_at.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS todotbl_deleted_at_idx ON todotbl (deleted_at) WHERE deleted_at IS NOT NULL;
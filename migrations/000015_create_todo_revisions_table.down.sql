@@ -0,0 +1,3 @@
+-- Filename: migrations/000015_create_todo_revisions_table.down.sql
+
+DROP TABLE IF EXISTS todo_revisions;
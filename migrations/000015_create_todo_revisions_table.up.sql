@@ -0,0 +1,13 @@
+-- Filename: migrations/000015_create_todo_revisions_table.up.sql
+
+CREATE TABLE IF NOT EXISTS todo_revisions (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todotbl ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    changes jsonb NOT NULL DEFAULT '{}',
+    snapshot jsonb NOT NULL,
+    actor text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (todo_id, version)
+);
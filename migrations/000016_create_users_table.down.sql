@@ -0,0 +1,3 @@
+-- Filename: migrations/000016_create_users_table.down.sql
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,5 @@
+-- Filename: migrations/000018_add_todo_owner.down.sql
+
+DROP INDEX IF EXISTS todotbl_owner_id_idx;
+ALTER TABLE todotbl DROP COLUMN IF EXISTS owner_id;
+DELETE FROM users WHERE email = 'legacy-owner@localhost';
@@ -0,0 +1,18 @@
+-- Filename: migrations/000018_add_todo_owner.up.sql
+
+ALTER TABLE todotbl ADD COLUMN IF NOT EXISTS owner_id bigint REFERENCES users ON DELETE CASCADE;
+
+-- Items which predate user accounts go to a legacy owner account. Nobody
+-- knows its password, so it stays locked until an administrator claims it
+-- with the -claim-email and -claim-password flags of the API
+INSERT INTO users (name, email, password_hash, activated)
+SELECT 'Legacy owner', 'legacy-owner@localhost', convert_to('$2a$12$mEc9QFMjX8SQmNPqBv8SeO6P3mpfNjmnH1ynaoLQO0lpUd31pg7yy', 'UTF8'), false
+WHERE EXISTS(SELECT 1 FROM todotbl WHERE owner_id IS NULL)
+ON CONFLICT (email) DO NOTHING;
+
+UPDATE todotbl SET owner_id = (SELECT id FROM users WHERE email = 'legacy-owner@localhost')
+WHERE owner_id IS NULL;
+
+ALTER TABLE todotbl ALTER COLUMN owner_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS todotbl_owner_id_idx ON todotbl (owner_id);
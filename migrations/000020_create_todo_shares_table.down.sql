@@ -0,0 +1,3 @@
+-- Filename: migrations/000020_create_todo_shares_table.down.sql
+
+DROP TABLE IF EXISTS todo_shares;
@@ -0,0 +1,12 @@
+-- Filename: migrations/000020_create_todo_shares_table.up.sql
+
+CREATE TABLE IF NOT EXISTS todo_shares (
+    todo_id bigint NOT NULL REFERENCES todotbl ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (todo_id, user_id),
+    CONSTRAINT todo_shares_role_check CHECK (role IN ('viewer', 'editor', 'owner'))
+);
+
+CREATE INDEX IF NOT EXISTS todo_shares_user_id_idx ON todo_shares (user_id);
@@ -0,0 +1,27 @@
+-- Filename: migrations/000022_add_list_tag_owner.down.sql
+
+-- Fold the copies made for each owner back into the oldest list or tag with
+-- the same name
+UPDATE todotbl SET list_id = k.id
+FROM lists l, (SELECT MIN(id) AS id, name FROM lists GROUP BY name) k
+WHERE todotbl.list_id = l.id
+AND l.name = k.name
+AND l.id <> k.id;
+
+DELETE FROM lists WHERE id NOT IN (SELECT MIN(id) FROM lists GROUP BY name);
+
+INSERT INTO todo_tags (todo_id, tag_id)
+SELECT tt.todo_id, k.id
+FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id
+JOIN (SELECT MIN(id) AS id, name FROM tags GROUP BY name) k ON k.name = g.name
+WHERE g.id <> k.id
+ON CONFLICT DO NOTHING;
+
+DELETE FROM tags WHERE id NOT IN (SELECT MIN(id) FROM tags GROUP BY name);
+
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_owner_id_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name);
+ALTER TABLE tags DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE lists DROP CONSTRAINT IF EXISTS lists_owner_id_name_key;
+ALTER TABLE lists ADD CONSTRAINT lists_name_key UNIQUE (name);
+ALTER TABLE lists DROP COLUMN IF EXISTS owner_id;
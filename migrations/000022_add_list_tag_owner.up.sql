@@ -0,0 +1,69 @@
+-- Filename: migrations/000022_add_list_tag_owner.up.sql
+
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS owner_id bigint REFERENCES users ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS owner_id bigint REFERENCES users ON DELETE CASCADE;
+
+-- Names only have to be unique for each owner
+ALTER TABLE lists DROP CONSTRAINT IF EXISTS lists_name_key;
+ALTER TABLE lists ADD CONSTRAINT lists_owner_id_name_key UNIQUE (owner_id, name);
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_owner_id_name_key UNIQUE (owner_id, name);
+
+-- Each list goes to the owner of its first item. Other owners with items in
+-- the list get a copy of their own
+UPDATE lists SET owner_id = (
+    SELECT t.owner_id FROM todotbl t
+    WHERE t.list_id = lists.id
+    ORDER BY t.id ASC
+    LIMIT 1
+);
+
+INSERT INTO lists (name, archived, owner_id)
+SELECT DISTINCT l.name, l.archived, t.owner_id
+FROM todotbl t JOIN lists l ON l.id = t.list_id
+WHERE t.owner_id <> l.owner_id;
+
+UPDATE todotbl SET list_id = c.id
+FROM lists l, lists c
+WHERE todotbl.list_id = l.id
+AND todotbl.owner_id <> l.owner_id
+AND c.owner_id = todotbl.owner_id
+AND c.name = l.name;
+
+-- Tags are split between owners the same way
+UPDATE tags SET owner_id = (
+    SELECT t.owner_id FROM todo_tags tt JOIN todotbl t ON t.id = tt.todo_id
+    WHERE tt.tag_id = tags.id
+    ORDER BY t.id ASC
+    LIMIT 1
+);
+
+INSERT INTO tags (name, owner_id)
+SELECT DISTINCT g.name, t.owner_id
+FROM todo_tags tt JOIN todotbl t ON t.id = tt.todo_id JOIN tags g ON g.id = tt.tag_id
+WHERE t.owner_id <> g.owner_id;
+
+UPDATE todo_tags SET tag_id = c.id
+FROM todotbl t, tags g, tags c
+WHERE todo_tags.todo_id = t.id
+AND todo_tags.tag_id = g.id
+AND t.owner_id <> g.owner_id
+AND c.owner_id = t.owner_id
+AND c.name = g.name;
+
+-- Lists and tags without any items go to the legacy owner account from
+-- migration 000018, which is created here if there were no items at all
+INSERT INTO users (name, email, password_hash, activated)
+SELECT 'Legacy owner', 'legacy-owner@localhost', convert_to('$2a$12$mEc9QFMjX8SQmNPqBv8SeO6P3mpfNjmnH1ynaoLQO0lpUd31pg7yy', 'UTF8'), false
+WHERE EXISTS(SELECT 1 FROM lists WHERE owner_id IS NULL)
+OR EXISTS(SELECT 1 FROM tags WHERE owner_id IS NULL)
+ON CONFLICT (email) DO NOTHING;
+
+UPDATE lists SET owner_id = (SELECT id FROM users WHERE email = 'legacy-owner@localhost')
+WHERE owner_id IS NULL;
+
+UPDATE tags SET owner_id = (SELECT id FROM users WHERE email = 'legacy-owner@localhost')
+WHERE owner_id IS NULL;
+
+ALTER TABLE lists ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE tags ALTER COLUMN owner_id SET NOT NULL;
@@ -75,12 +75,12 @@ view model =
         [ label [ attribute "aria-hidden" "true", for "chk" ]
             [ text "To-Do List Form" ]
         , div []
-        [ viewInput "text" "Task Name" model.task_name Task_Name
-        , viewInput "text" "Description" model.description Description
-        , viewInput "text" "Notes" model.notes Notes
-        , viewInput "text" "Category" model.category Category
-        , viewInput "text" "Priority" model.priority Priority
-        , viewInput "text" "Status" model.status Status
+        [ viewInput "text" "task_name" "Task Name" model.task_name Task_Name
+        , viewInput "text" "description" "Description" model.description Description
+        , viewInput "text" "notes" "Notes" model.notes Notes
+        , viewInput "text" "category" "Category" model.category Category
+        , viewInput "text" "priority" "Priority" model.priority Priority
+        , viewInput "text" "status" "Status" model.status Status
         , viewValidation model
         ]
         , button []
@@ -90,9 +90,9 @@ view model =
   ]
 
 
-viewInput : String -> String -> String -> (String -> msg) -> Html msg
-viewInput t p v toMsg =
-  input [ type_ t, placeholder p, value v, onInput toMsg ] []
+viewInput : String -> String -> String -> String -> (String -> msg) -> Html msg
+viewInput t n p v toMsg =
+  input [ type_ t, name n, placeholder p, value v, onInput toMsg ] []
 
 
 viewValidation : Model -> Html msg